@@ -23,6 +23,8 @@ type LogContext struct {
 	SessionID      string `json:"session_id,omitempty"`
 	ActionID       string `json:"action_id,omitempty"`
 	RequestID      string `json:"request_id,omitempty"`
+	TraceID        string `json:"trace_id,omitempty"`
+	SpanID         string `json:"span_id,omitempty"`
 	TenantCode     string `json:"tenant_code,omitempty"`
 	Service        string `json:"service,omitempty"`
 
@@ -94,10 +96,12 @@ func New(serviceName string, req *http.Request, options ...func(*LogContext)) *L
 		params[k] = v[0]
 	}
 
-	var aid, rid string
+	var aid, rid, traceID, spanID string
 	if cb := ctxbase.FromCtx(req.Context()); cb != nil {
 		aid = cb.ActionID
 		rid = cb.RequestID
+		traceID = cb.TraceID
+		spanID = cb.SpanID
 	} else {
 		aid = ctxbase.NewID()
 		rid = req.Header.Get(HeaderXRequestID)
@@ -111,6 +115,8 @@ func New(serviceName string, req *http.Request, options ...func(*LogContext)) *L
 		ParentActionID: req.Header.Get(HeaderXActionID),
 		ActionID:       aid,
 		RequestID:      rid,
+		TraceID:        traceID,
+		SpanID:         spanID,
 
 		Timestamp:     time.Now(),
 		RemoteIP:      realIP,
@@ -157,6 +163,7 @@ func (c *LogContext) Clone() *LogContext {
 		ParentActionID: c.ActionID,
 		ActionID:       ctxbase.NewID(),
 		RequestID:      c.RequestID,
+		TraceID:        c.TraceID,
 		Timestamp:      time.Now(),
 		RemoteIP:       c.RemoteIP,
 		Host:           c.Host,
@@ -2,16 +2,25 @@ package behaviorlog
 
 import "context"
 
+// LogContextName is the old context key of LogContext, which is still set by ToCtx and looked up by FromCtx.
+//
+// Deprecated: use FromCtx and LogContext.ToCtx.
 const LogContextName = "behaviorlog"
 
+type contextKey struct{}
+
 func (c *LogContext) ToCtx(ctx context.Context) context.Context {
-	return context.WithValue(ctx, LogContextName, c)
+	// the old key is still set for code that reads it directly
+	return context.WithValue(context.WithValue(ctx, LogContextName, c), contextKey{}, c)
 }
 func FromCtx(ctx context.Context) *LogContext {
 	if ctx == nil {
 		return NewNopContext()
 	}
-	v := ctx.Value(LogContextName)
+	v := ctx.Value(contextKey{})
+	if v == nil {
+		v = ctx.Value(LogContextName)
+	}
 	if v == nil {
 		return NewNopContext()
 	}
@@ -0,0 +1,21 @@
+package behaviorlog_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/behaviorlog"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestFromCtx(t *testing.T) {
+	c := &behaviorlog.LogContext{RequestID: "req-1"}
+	test.Equals(t, c, behaviorlog.FromCtx(c.ToCtx(context.Background())))
+
+	// the old key is still set and supported
+	test.Equals(t, c, c.ToCtx(context.Background()).Value(behaviorlog.LogContextName))
+	ctx := context.WithValue(context.Background(), behaviorlog.LogContextName, c)
+	test.Equals(t, c, behaviorlog.FromCtx(ctx))
+
+	test.Equals(t, "", behaviorlog.FromCtx(context.Background()).RequestID)
+}
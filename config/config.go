@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"github.com/spf13/viper"
 )
@@ -14,6 +15,14 @@ func SetConfigPath(in string) {
 	configPath = in
 	viper.AddConfigPath(in)
 }
+
+// Validator is implemented by config values which can be invalid, e.g. number.Setting.
+type Validator interface {
+	Validate() error
+}
+
+// Read reads config.yml, merges config.<env>.yml, and unmarshals it into config.
+// Values implementing Validator in config are validated, so e.g. an unknown round strategy is rejected.
 func Read(env string, config interface{}) error {
 	viper.SetConfigName("config")
 	viper.AddConfigPath(configPath)
@@ -34,5 +43,81 @@ func Read(env string, config interface{}) error {
 	if err := viper.Unmarshal(config); err != nil {
 		return fmt.Errorf("Fatal error config file: %s \n", err)
 	}
+	if err := validate(reflect.ValueOf(config), ""); err != nil {
+		return fmt.Errorf("Fatal error config file: %s \n", err)
+	}
+	return nil
+}
+
+// validate calls Validate of v and of the values in it.
+func validate(v reflect.Value, path string) error {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+	} else if v.CanAddr() {
+		// Validate may have a pointer receiver
+		if err := validateValue(v.Addr(), path); err != nil {
+			return err
+		}
+		return validateFields(v, path)
+	}
+	if err := validateValue(v, path); err != nil {
+		return err
+	}
+	return validateFields(v, path)
+}
+
+func validateValue(v reflect.Value, path string) error {
+	if !v.CanInterface() {
+		return nil
+	}
+	if validator, ok := v.Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			if path == "" {
+				return err
+			}
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func validateFields(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return validateFields(v.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := validate(v.Field(i), join(path, v.Type().Field(i).Name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validate(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if err := validate(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, k)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
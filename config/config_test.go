@@ -3,9 +3,11 @@ package config_test
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/pangpanglabs/goutils/config"
+	"github.com/pangpanglabs/goutils/number"
 	"github.com/pangpanglabs/goutils/test"
 )
 
@@ -45,3 +47,16 @@ func TestConfig(t *testing.T) {
 	test.Equals(t, c.Debug, true)
 	test.Equals(t, c.Httpport, "8080")
 }
+
+func TestConfigValidate(t *testing.T) {
+	var c struct {
+		Number number.Setting
+	}
+
+	err := ioutil.WriteFile("./config.yml", []byte("number:\n  rounddigit: 2\n  roundstrategy: rnd"), 0666)
+	test.Ok(t, err)
+	defer os.Remove("./config.yml")
+
+	err = config.Read("", &c)
+	test.Assert(t, err != nil && strings.Contains(err.Error(), `Number: number: unknown round strategy "rnd"`), "expected unknown round strategy, got %v", err)
+}
@@ -0,0 +1,171 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrEmptyItem       = errors.New("empty item")
+	ErrInvalidRange    = errors.New("invalid range")
+	ErrRangeNotAllowed = errors.New("range is not allowed")
+	ErrTooManyItems    = errors.New("too many items")
+)
+
+// ParseError reports the item that could not be parsed.
+// Index is the position of the item in the list (starting from 0),
+// Offset is the byte offset of the item in the original string.
+type ParseError struct {
+	Index  int
+	Offset int
+	Item   string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("converter: item %d (offset %d) %q: %v", e.Index, e.Offset, e.Item, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultMaxRangeItems is the limit of parsed items if ranges are allowed and MaxItems is not set,
+// so that a range like "0-9223372036854775806" from a query param can't exhaust memory.
+const DefaultMaxRangeItems = 10000
+
+type ParseConfig struct {
+	// Separators is the set of characters that separate items. Default is ",".
+	Separators string
+	// AllowRange enables ranges like "1-5", which are expanded to 1,2,3,4,5.
+	AllowRange bool
+	// MaxItems limits the number of parsed items (after range expansion).
+	// 0 means unlimited without ranges, and DefaultMaxRangeItems with ranges.
+	MaxItems int
+}
+
+func WithSeparators(separators string) func(*ParseConfig) {
+	return func(c *ParseConfig) {
+		c.Separators = separators
+	}
+}
+
+// WithRange allows ranges like "1-5". The expanded items are limited by WithMaxItems, or DefaultMaxRangeItems.
+func WithRange() func(*ParseConfig) {
+	return func(c *ParseConfig) {
+		c.AllowRange = true
+	}
+}
+
+func WithMaxItems(n int) func(*ParseConfig) {
+	return func(c *ParseConfig) {
+		c.MaxItems = n
+	}
+}
+
+func newParseConfig(options []func(*ParseConfig)) ParseConfig {
+	c := ParseConfig{Separators: ","}
+	for _, option := range options {
+		if option != nil {
+			option(&c)
+		}
+	}
+	if c.Separators == "" {
+		c.Separators = ","
+	}
+	if c.AllowRange && c.MaxItems <= 0 {
+		c.MaxItems = DefaultMaxRangeItems
+	}
+	return c
+}
+
+// StringToIntSliceStrict is the strict version of StringToIntSlice.
+// Unlike StringToIntSlice, it keeps zeros and returns a *ParseError for the first invalid item.
+// An empty (or blank) string results in an empty list.
+func StringToIntSliceStrict(s string, options ...func(*ParseConfig)) ([]int64, error) {
+	c := newParseConfig(options)
+
+	var list []int64
+	if strings.TrimSpace(s) == "" {
+		return list, nil
+	}
+
+	index, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && strings.IndexByte(c.Separators, s[i]) < 0 {
+			continue
+		}
+		item := s[start:i]
+		offset := start + len(item) - len(strings.TrimLeft(item, " \t\r\n"))
+		var err error
+		if list, err = c.appendItem(list, strings.TrimSpace(item)); err != nil {
+			return nil, &ParseError{Index: index, Offset: offset, Item: strings.TrimSpace(item), Err: err}
+		}
+		index++
+		start = i + 1
+	}
+
+	return list, nil
+}
+
+// StringSliceToInt64SliceStrict is the strict version of StringSliceToInt64Slice.
+// Every element must be a valid number (or a range if enabled by WithRange),
+// otherwise a *ParseError is returned. Separators are not used.
+func StringSliceToInt64SliceStrict(s []string, options ...func(*ParseConfig)) ([]int64, error) {
+	c := newParseConfig(options)
+
+	var list []int64
+	for i, v := range s {
+		var err error
+		if list, err = c.appendItem(list, strings.TrimSpace(v)); err != nil {
+			return nil, &ParseError{Index: i, Offset: -1, Item: v, Err: err}
+		}
+	}
+	return list, nil
+}
+
+func (c ParseConfig) appendItem(list []int64, item string) ([]int64, error) {
+	if item == "" {
+		return list, ErrEmptyItem
+	}
+
+	// a leading "-" is a sign, so the range separator is searched from the second character
+	if i := strings.IndexByte(item[1:], '-'); i >= 0 {
+		if !c.AllowRange {
+			return list, ErrRangeNotAllowed
+		}
+		from, err := strconv.ParseInt(strings.TrimSpace(item[:i+1]), 10, 64)
+		if err != nil {
+			return list, err
+		}
+		to, err := strconv.ParseInt(strings.TrimSpace(item[i+2:]), 10, 64)
+		if err != nil {
+			return list, err
+		}
+		if from > to {
+			return list, ErrInvalidRange
+		}
+		// check the limit before expanding, so that "1-999999999" can't exhaust memory
+		if c.MaxItems > 0 && uint64(to-from) >= uint64(c.MaxItems-len(list)) {
+			return list, ErrTooManyItems
+		}
+		for n := from; ; n++ {
+			list = append(list, n)
+			if n == to {
+				break
+			}
+		}
+		return list, nil
+	}
+
+	n, err := strconv.ParseInt(item, 10, 64)
+	if err != nil {
+		return list, err
+	}
+	if c.MaxItems > 0 && len(list) >= c.MaxItems {
+		return list, ErrTooManyItems
+	}
+	return append(list, n), nil
+}
@@ -0,0 +1,84 @@
+package converter_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/converter"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestStringToIntSliceStrict(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		list, err := converter.StringToIntSliceStrict("1,2, 0 ,-4")
+		test.Ok(t, err)
+		test.Equals(t, []int64{1, 2, 0, -4}, list)
+	})
+	t.Run("blank", func(t *testing.T) {
+		list, err := converter.StringToIntSliceStrict("  ")
+		test.Ok(t, err)
+		test.Equals(t, 0, len(list))
+	})
+	t.Run("separators", func(t *testing.T) {
+		list, err := converter.StringToIntSliceStrict("1;2|3", converter.WithSeparators(";|"))
+		test.Ok(t, err)
+		test.Equals(t, []int64{1, 2, 3}, list)
+	})
+	t.Run("range", func(t *testing.T) {
+		list, err := converter.StringToIntSliceStrict("1-5,9,-2--1", converter.WithRange())
+		test.Ok(t, err)
+		test.Equals(t, []int64{1, 2, 3, 4, 5, 9, -2, -1}, list)
+	})
+	t.Run("invalid item", func(t *testing.T) {
+		_, err := converter.StringToIntSliceStrict("1,2, x3")
+		var parseErr *converter.ParseError
+		test.Assert(t, errors.As(err, &parseErr), "expected ParseError, got %v", err)
+		test.Equals(t, 2, parseErr.Index)
+		test.Equals(t, 5, parseErr.Offset)
+		test.Equals(t, "x3", parseErr.Item)
+		test.Assert(t, errors.Is(err, strconv.ErrSyntax), "expected ErrSyntax, got %v", err)
+	})
+	t.Run("empty item", func(t *testing.T) {
+		_, err := converter.StringToIntSliceStrict("1,,2")
+		test.Assert(t, errors.Is(err, converter.ErrEmptyItem), "expected ErrEmptyItem, got %v", err)
+	})
+	t.Run("range not allowed", func(t *testing.T) {
+		_, err := converter.StringToIntSliceStrict("1-5")
+		test.Assert(t, errors.Is(err, converter.ErrRangeNotAllowed), "expected ErrRangeNotAllowed, got %v", err)
+	})
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := converter.StringToIntSliceStrict("5-1", converter.WithRange())
+		test.Assert(t, errors.Is(err, converter.ErrInvalidRange), "expected ErrInvalidRange, got %v", err)
+	})
+	t.Run("max items", func(t *testing.T) {
+		list, err := converter.StringToIntSliceStrict("1-3,4", converter.WithRange(), converter.WithMaxItems(4))
+		test.Ok(t, err)
+		test.Equals(t, []int64{1, 2, 3, 4}, list)
+
+		_, err = converter.StringToIntSliceStrict("1,2-9999999999", converter.WithRange(), converter.WithMaxItems(100))
+		test.Assert(t, errors.Is(err, converter.ErrTooManyItems), "expected ErrTooManyItems, got %v", err)
+
+		_, err = converter.StringToIntSliceStrict("1,2,3", converter.WithMaxItems(2))
+		test.Assert(t, errors.Is(err, converter.ErrTooManyItems), "expected ErrTooManyItems, got %v", err)
+	})
+	t.Run("default max items of ranges", func(t *testing.T) {
+		_, err := converter.StringToIntSliceStrict("0-9223372036854775806", converter.WithRange())
+		test.Assert(t, errors.Is(err, converter.ErrTooManyItems), "expected ErrTooManyItems, got %v", err)
+
+		list, err := converter.StringToIntSliceStrict("1-10000", converter.WithRange())
+		test.Ok(t, err)
+		test.Equals(t, converter.DefaultMaxRangeItems, len(list))
+	})
+}
+
+func TestStringSliceToInt64SliceStrict(t *testing.T) {
+	list, err := converter.StringSliceToInt64SliceStrict([]string{"1", " 2", "0"})
+	test.Ok(t, err)
+	test.Equals(t, []int64{1, 2, 0}, list)
+
+	_, err = converter.StringSliceToInt64SliceStrict([]string{"1", "a"})
+	var parseErr *converter.ParseError
+	test.Assert(t, errors.As(err, &parseErr), "expected ParseError, got %v", err)
+	test.Equals(t, 1, parseErr.Index)
+}
@@ -0,0 +1,171 @@
+package converter
+
+// The functions in this file never modify their arguments.
+// Results of Distinct/Intersect/Difference/Union keep the order in which elements
+// first appear (in a, then b), contain no duplicates, and are newly allocated,
+// so they can be modified freely. Membership is checked with a map,
+// so each call costs O(len(a)+len(b)) time plus one map and one result allocation.
+
+// DistinctInt64 returns the elements of s without duplicates, keeping the first occurrence.
+// Unlike UniqueInt64, s is not modified.
+func DistinctInt64(s []int64) []int64 {
+	m := make(map[int64]struct{}, len(s))
+	list := make([]int64, 0, len(s))
+	for _, v := range s {
+		if _, ok := m[v]; ok {
+			continue
+		}
+		m[v] = struct{}{}
+		list = append(list, v)
+	}
+	return list
+}
+
+// IntersectInt64 returns the elements of a that are also in b, in the order of a.
+func IntersectInt64(a, b []int64) []int64 {
+	m := make(map[int64]bool, len(b))
+	for _, v := range b {
+		m[v] = true
+	}
+	list := make([]int64, 0, len(a))
+	for _, v := range a {
+		if m[v] {
+			list = append(list, v)
+			m[v] = false
+		}
+	}
+	return list
+}
+
+// DifferenceInt64 returns the elements of a that are not in b, in the order of a.
+func DifferenceInt64(a, b []int64) []int64 {
+	m := make(map[int64]struct{}, len(a)+len(b))
+	for _, v := range b {
+		m[v] = struct{}{}
+	}
+	list := make([]int64, 0, len(a))
+	for _, v := range a {
+		if _, ok := m[v]; ok {
+			continue
+		}
+		m[v] = struct{}{}
+		list = append(list, v)
+	}
+	return list
+}
+
+// UnionInt64 returns the elements of a followed by the elements of b that are not in a.
+func UnionInt64(a, b []int64) []int64 {
+	m := make(map[int64]struct{}, len(a)+len(b))
+	list := make([]int64, 0, len(a)+len(b))
+	for _, s := range [][]int64{a, b} {
+		for _, v := range s {
+			if _, ok := m[v]; ok {
+				continue
+			}
+			m[v] = struct{}{}
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ChunkInt64 splits s into chunks of at most size elements, e.g. for "IN (...)" queries.
+// The chunks share the backing array of s, so only the outer slice is allocated.
+// If size <= 0, s is returned as a single chunk.
+func ChunkInt64(s []int64, size int) [][]int64 {
+	if len(s) == 0 {
+		return nil
+	}
+	if size <= 0 || size >= len(s) {
+		return [][]int64{s}
+	}
+	chunks := make([][]int64, 0, (len(s)+size-1)/size)
+	for size < len(s) {
+		chunks = append(chunks, s[:size:size])
+		s = s[size:]
+	}
+	return append(chunks, s)
+}
+
+// DistinctString returns the elements of s without duplicates, keeping the first occurrence.
+// Unlike UniqueString, s is not modified.
+func DistinctString(s []string) []string {
+	m := make(map[string]struct{}, len(s))
+	list := make([]string, 0, len(s))
+	for _, v := range s {
+		if _, ok := m[v]; ok {
+			continue
+		}
+		m[v] = struct{}{}
+		list = append(list, v)
+	}
+	return list
+}
+
+// IntersectString returns the elements of a that are also in b, in the order of a.
+func IntersectString(a, b []string) []string {
+	m := make(map[string]bool, len(b))
+	for _, v := range b {
+		m[v] = true
+	}
+	list := make([]string, 0, len(a))
+	for _, v := range a {
+		if m[v] {
+			list = append(list, v)
+			m[v] = false
+		}
+	}
+	return list
+}
+
+// DifferenceString returns the elements of a that are not in b, in the order of a.
+func DifferenceString(a, b []string) []string {
+	m := make(map[string]struct{}, len(a)+len(b))
+	for _, v := range b {
+		m[v] = struct{}{}
+	}
+	list := make([]string, 0, len(a))
+	for _, v := range a {
+		if _, ok := m[v]; ok {
+			continue
+		}
+		m[v] = struct{}{}
+		list = append(list, v)
+	}
+	return list
+}
+
+// UnionString returns the elements of a followed by the elements of b that are not in a.
+func UnionString(a, b []string) []string {
+	m := make(map[string]struct{}, len(a)+len(b))
+	list := make([]string, 0, len(a)+len(b))
+	for _, s := range [][]string{a, b} {
+		for _, v := range s {
+			if _, ok := m[v]; ok {
+				continue
+			}
+			m[v] = struct{}{}
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ChunkString splits s into chunks of at most size elements.
+// The chunks share the backing array of s, so only the outer slice is allocated.
+// If size <= 0, s is returned as a single chunk.
+func ChunkString(s []string, size int) [][]string {
+	if len(s) == 0 {
+		return nil
+	}
+	if size <= 0 || size >= len(s) {
+		return [][]string{s}
+	}
+	chunks := make([][]string, 0, (len(s)+size-1)/size)
+	for size < len(s) {
+		chunks = append(chunks, s[:size:size])
+		s = s[size:]
+	}
+	return append(chunks, s)
+}
@@ -0,0 +1,131 @@
+package converter_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/converter"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestSetInt64(t *testing.T) {
+	a := []int64{3, 1, 2, 3, 5}
+	b := []int64{5, 4, 3, 4}
+	t.Run("DistinctInt64", func(t *testing.T) {
+		test.Equals(t, []int64{3, 1, 2, 5}, converter.DistinctInt64(a))
+		test.Equals(t, []int64{3, 1, 2, 3, 5}, a)
+	})
+	t.Run("IntersectInt64", func(t *testing.T) {
+		test.Equals(t, []int64{3, 5}, converter.IntersectInt64(a, b))
+		test.Equals(t, 0, len(converter.IntersectInt64(a, nil)))
+	})
+	t.Run("DifferenceInt64", func(t *testing.T) {
+		test.Equals(t, []int64{1, 2}, converter.DifferenceInt64(a, b))
+		test.Equals(t, []int64{4}, converter.DifferenceInt64(b, a))
+	})
+	t.Run("UnionInt64", func(t *testing.T) {
+		test.Equals(t, []int64{3, 1, 2, 5, 4}, converter.UnionInt64(a, b))
+	})
+	t.Run("ChunkInt64", func(t *testing.T) {
+		test.Equals(t, [][]int64{{3, 1}, {2, 3}, {5}}, converter.ChunkInt64(a, 2))
+		test.Equals(t, [][]int64{a}, converter.ChunkInt64(a, 5))
+		test.Equals(t, [][]int64{a}, converter.ChunkInt64(a, 0))
+		test.Equals(t, 0, len(converter.ChunkInt64(nil, 2)))
+
+		chunks := converter.ChunkInt64(a, 2)
+		chunks[0] = append(chunks[0], 100)
+		test.Equals(t, []int64{3, 1, 2, 3, 5}, a)
+	})
+}
+
+func TestSetString(t *testing.T) {
+	a := []string{"c", "a", "b", "c", "e"}
+	b := []string{"e", "d", "c", "d"}
+	t.Run("DistinctString", func(t *testing.T) {
+		test.Equals(t, []string{"c", "a", "b", "e"}, converter.DistinctString(a))
+	})
+	t.Run("IntersectString", func(t *testing.T) {
+		test.Equals(t, []string{"c", "e"}, converter.IntersectString(a, b))
+	})
+	t.Run("DifferenceString", func(t *testing.T) {
+		test.Equals(t, []string{"a", "b"}, converter.DifferenceString(a, b))
+	})
+	t.Run("UnionString", func(t *testing.T) {
+		test.Equals(t, []string{"c", "a", "b", "e", "d"}, converter.UnionString(a, b))
+	})
+	t.Run("ChunkString", func(t *testing.T) {
+		test.Equals(t, [][]string{{"c", "a", "b"}, {"c", "e"}}, converter.ChunkString(a, 3))
+	})
+}
+
+func benchmarkInt64s(n, offset int) []int64 {
+	s := make([]int64, n)
+	for i := range s {
+		s[i] = int64(i + offset)
+	}
+	return s
+}
+
+func benchmarkStrings(n, offset int) []string {
+	s := make([]string, n)
+	for i := range s {
+		s[i] = strconv.Itoa(i + offset)
+	}
+	return s
+}
+
+func BenchmarkDistinctInt64(b *testing.B) {
+	s := append(benchmarkInt64s(100000, 0), benchmarkInt64s(100000, 0)...)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.DistinctInt64(s)
+	}
+}
+
+func BenchmarkIntersectInt64(b *testing.B) {
+	x, y := benchmarkInt64s(100000, 0), benchmarkInt64s(100000, 50000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.IntersectInt64(x, y)
+	}
+}
+
+func BenchmarkDifferenceInt64(b *testing.B) {
+	x, y := benchmarkInt64s(100000, 0), benchmarkInt64s(100000, 50000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.DifferenceInt64(x, y)
+	}
+}
+
+func BenchmarkUnionInt64(b *testing.B) {
+	x, y := benchmarkInt64s(100000, 0), benchmarkInt64s(100000, 50000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.UnionInt64(x, y)
+	}
+}
+
+func BenchmarkChunkInt64(b *testing.B) {
+	s := benchmarkInt64s(100000, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.ChunkInt64(s, 500)
+	}
+}
+
+func BenchmarkIntersectString(b *testing.B) {
+	x, y := benchmarkStrings(100000, 0), benchmarkStrings(100000, 50000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.IntersectString(x, y)
+	}
+}
+
+func BenchmarkUnionString(b *testing.B) {
+	x, y := benchmarkStrings(100000, 0), benchmarkStrings(100000, 50000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		converter.UnionString(x, y)
+	}
+}
@@ -0,0 +1,398 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeLayouts are the layouts tried in order when a string is converted to time.Time by FromMap.
+var TimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// FieldError describes a value in the map that could not be assigned to a struct field.
+// Field is the dotted key of the field, e.g. "address.city".
+type FieldError struct {
+	Field string
+	Value interface{}
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("converter: field %q: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors is returned by FromMap when one or more fields could not be assigned.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ToMap flattens a struct (or a pointer to struct) into a map.
+// Keys are taken from the `json` tag (or the field name), fields tagged "-" and unexported fields are skipped,
+// and "omitempty" skips zero values. Nested structs are flattened with dotted keys, e.g. "address.city",
+// while embedded structs without a tag are inlined like encoding/json does. time.Time is kept as a value.
+// ToMap returns nil if v is not a struct.
+func ToMap(v interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	m := map[string]interface{}{}
+	toMap(m, "", rv)
+	return m
+}
+
+func toMap(m map[string]interface{}, prefix string, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, omitempty, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if omitempty && isEmptyValue(fv) {
+			continue
+		}
+
+		if sv, ok := structValue(fv); ok {
+			if f.Anonymous && name == f.Name {
+				toMap(m, prefix, sv)
+			} else {
+				toMap(m, prefix+name+".", sv)
+			}
+			continue
+		}
+		m[prefix+name] = fv.Interface()
+	}
+}
+
+// FromMap assigns the values of m to the struct pointed to by v, using the same keys as ToMap.
+// Nested structs can be given either with dotted keys ("address.city") or as nested maps.
+// Values are converted to the field type where possible: strings and json.Number to numbers and bools,
+// strings to time.Time (see TimeLayouts), numbers to strings, and a []string or a comma separated
+// string to slices. Keys without a matching field are ignored.
+// All fields are processed, and the failed ones are returned as FieldErrors.
+func FromMap(m map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("converter: FromMap requires a non-nil pointer to struct")
+	}
+
+	var errs FieldErrors
+	fromMap(m, "", rv.Elem(), &errs)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func fromMap(m map[string]interface{}, prefix string, rv reflect.Value, errs *FieldErrors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, _, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+
+		if isStructType(f.Type) {
+			if f.Anonymous && name == f.Name {
+				fromMap(m, prefix, settableStruct(fv), errs)
+				continue
+			}
+			if nested, ok := m[prefix+name].(map[string]interface{}); ok {
+				fromMap(nested, "", settableStruct(fv), errs)
+				continue
+			}
+			if hasPrefix(m, prefix+name+".") {
+				fromMap(m, prefix+name+".", settableStruct(fv), errs)
+				continue
+			}
+		}
+
+		value, ok := m[prefix+name]
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, value); err != nil {
+			*errs = append(*errs, &FieldError{Field: prefix + name, Value: value, Err: err})
+		}
+	}
+}
+
+func setValue(fv reflect.Value, value interface{}) error {
+	if value == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	vv := reflect.ValueOf(value)
+	if vv.Type().AssignableTo(fv.Type()) {
+		fv.Set(vv)
+		return nil
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		p := reflect.New(fv.Type().Elem())
+		if err := setValue(p.Elem(), value); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+
+	// a single query param is often given as []string
+	if ss, ok := value.([]string); ok && fv.Kind() != reflect.Slice {
+		if len(ss) == 0 {
+			return nil
+		}
+		return setValue(fv, ss[0])
+	}
+
+	if fv.Type() == timeType {
+		s, ok := value.(string)
+		if !ok {
+			return conversionError(value, fv.Type())
+		}
+		for _, layout := range TimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				fv.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot parse %q as time", s)
+	}
+
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, fv.Type())
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+		if n < 0 || fv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%d overflows %s", n, fv.Type())
+		}
+		fv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, err := toFloat64(value)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowFloat(n) {
+			return fmt.Errorf("%v overflows %s", n, fv.Type())
+		}
+		fv.SetFloat(n)
+	case reflect.Bool:
+		switch b := value.(type) {
+		case string:
+			v, err := strconv.ParseBool(strings.TrimSpace(b))
+			if err != nil {
+				return err
+			}
+			fv.SetBool(v)
+		default:
+			return conversionError(value, fv.Type())
+		}
+	case reflect.String:
+		switch vv.Kind() {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			fv.SetString(fmt.Sprint(value))
+		default:
+			return conversionError(value, fv.Type())
+		}
+	case reflect.Slice:
+		if s, ok := value.(string); ok {
+			value = StringToStringSlice(s)
+			vv = reflect.ValueOf(value)
+		}
+		if vv.Kind() != reflect.Slice && vv.Kind() != reflect.Array {
+			return conversionError(value, fv.Type())
+		}
+		list := reflect.MakeSlice(fv.Type(), vv.Len(), vv.Len())
+		for i := 0; i < vv.Len(); i++ {
+			if err := setValue(list.Index(i), vv.Index(i).Interface()); err != nil {
+				return fmt.Errorf("index %d: %v", i, err)
+			}
+		}
+		fv.Set(list)
+	default:
+		if vv.Type().ConvertibleTo(fv.Type()) {
+			fv.Set(vv.Convert(fv.Type()))
+			return nil
+		}
+		return conversionError(value, fv.Type())
+	}
+	return nil
+}
+
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	case json.Number:
+		return v.Int64()
+	}
+	vv := reflect.ValueOf(value)
+	switch vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return vv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if vv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", vv.Uint())
+		}
+		return int64(vv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := vv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an integer", f)
+		}
+		return int64(f), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to integer", value)
+}
+
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case json.Number:
+		return v.Float64()
+	}
+	vv := reflect.ValueOf(value)
+	switch vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(vv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(vv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return vv.Float(), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to float", value)
+}
+
+func conversionError(value interface{}, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %T to %s", value, t)
+}
+
+// jsonFieldName returns the key of a struct field and whether it has the omitempty option.
+// ok is false if the field should be skipped.
+func jsonFieldName(f reflect.StructField) (name string, omitempty, ok bool) {
+	// embedded unexported structs are inlined, other unexported fields are skipped
+	if f.PkgPath != "" && !(f.Anonymous && f.Type.Kind() == reflect.Struct) {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
+
+func isStructType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// structValue returns the struct behind fv if it should be flattened.
+func structValue(fv reflect.Value) (reflect.Value, bool) {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return fv, false
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() != reflect.Struct || fv.Type() == timeType {
+		return fv, false
+	}
+	return fv, true
+}
+
+// settableStruct returns the struct behind fv, allocating it if fv is a nil pointer.
+func settableStruct(fv reflect.Value) reflect.Value {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return fv.Elem()
+	}
+	return fv
+}
+
+func hasPrefix(m map[string]interface{}, prefix string) bool {
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
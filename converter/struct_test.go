@@ -0,0 +1,114 @@
+package converter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/converter"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type testBase struct {
+	TenantCode string `json:"tenantCode"`
+}
+
+type testAddress struct {
+	City string `json:"city"`
+	Zip  int    `json:"zip,omitempty"`
+}
+
+type testOrder struct {
+	testBase
+	ID        int64        `json:"id"`
+	StoreIDs  []int64      `json:"storeIds,omitempty"`
+	Paid      bool         `json:"paid"`
+	Amount    float64      `json:"amount"`
+	Remark    string       `json:"remark,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Address   testAddress  `json:"address"`
+	Billing   *testAddress `json:"billing,omitempty"`
+	Password  string       `json:"-"`
+	secret    string
+}
+
+func TestToMap(t *testing.T) {
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := converter.ToMap(&testOrder{
+		testBase:  testBase{TenantCode: "pangpang"},
+		ID:        1,
+		Paid:      true,
+		Amount:    9.9,
+		CreatedAt: createdAt,
+		Address:   testAddress{City: "Seoul"},
+		Password:  "123",
+		secret:    "456",
+	})
+	test.Equals(t, map[string]interface{}{
+		"tenantCode":   "pangpang",
+		"id":           int64(1),
+		"paid":         true,
+		"amount":       9.9,
+		"createdAt":    createdAt,
+		"address.city": "Seoul",
+	}, m)
+
+	test.Equals(t, map[string]interface{}(nil), converter.ToMap(1))
+}
+
+func TestFromMap(t *testing.T) {
+	t.Run("coercion", func(t *testing.T) {
+		var o testOrder
+		err := converter.FromMap(map[string]interface{}{
+			"tenantCode":   "pangpang",
+			"id":           json.Number("12"),
+			"storeIds":     "1,2,3",
+			"paid":         "true",
+			"amount":       "9.9",
+			"remark":       []string{"first", "second"},
+			"createdAt":    "2020-01-02",
+			"address.city": "Seoul",
+			"address.zip":  "100",
+			"billing":      map[string]interface{}{"city": "Shanghai"},
+			"unknown":      "x",
+		}, &o)
+		test.Ok(t, err)
+		test.Equals(t, "pangpang", o.TenantCode)
+		test.Equals(t, int64(12), o.ID)
+		test.Equals(t, []int64{1, 2, 3}, o.StoreIDs)
+		test.Equals(t, true, o.Paid)
+		test.Equals(t, 9.9, o.Amount)
+		test.Equals(t, "first", o.Remark)
+		test.Equals(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), o.CreatedAt)
+		test.Equals(t, testAddress{City: "Seoul", Zip: 100}, o.Address)
+		test.Equals(t, &testAddress{City: "Shanghai"}, o.Billing)
+	})
+	t.Run("round trip", func(t *testing.T) {
+		in := testOrder{ID: 1, Amount: 1.5, Address: testAddress{City: "Seoul", Zip: 1}}
+		var out testOrder
+		test.Ok(t, converter.FromMap(converter.ToMap(in), &out))
+		test.Equals(t, in, out)
+	})
+	t.Run("field errors", func(t *testing.T) {
+		var o testOrder
+		err := converter.FromMap(map[string]interface{}{
+			"id":          "x",
+			"paid":        "yes",
+			"address.zip": 1.5,
+			"amount":      "1",
+		}, &o)
+		var errs converter.FieldErrors
+		test.Assert(t, errors.As(err, &errs), "expected FieldErrors, got %v", err)
+		fields := map[string]bool{}
+		for _, e := range errs {
+			fields[e.Field] = true
+		}
+		test.Equals(t, map[string]bool{"id": true, "paid": true, "address.zip": true}, fields)
+		test.Equals(t, 1.0, o.Amount)
+	})
+	t.Run("invalid target", func(t *testing.T) {
+		var o testOrder
+		test.Assert(t, converter.FromMap(nil, o) != nil, "expected error")
+	})
+}
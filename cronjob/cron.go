@@ -7,14 +7,16 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/pangpanglabs/goutils/ctxbase"
 	"github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 )
 
 type Cron struct {
-	name  string
-	cron  *cron.Cron
-	chain middlewareChain
+	name    string
+	cron    *cron.Cron
+	chain   middlewareChain
+	baggage ctxbase.Baggage
 }
 
 type Job struct {
@@ -24,8 +26,9 @@ type Job struct {
 
 func New(name string) *Cron {
 	c := Cron{
-		name: name,
-		cron: cron.New(),
+		name:    name,
+		cron:    cron.New(),
+		baggage: ctxbase.Baggage{},
 	}
 
 	c.chain.append(
@@ -39,14 +42,21 @@ func (c *Cron) Use(middlewares ...Middleware) {
 	c.chain.append(middlewares...)
 }
 
+// SetBaggage adds a baggage member which is propagated by every run, e.g. the tenant the jobs work for.
+// It should be called before Start.
+func (c *Cron) SetBaggage(key, value string) error {
+	return c.baggage.Set(key, value)
+}
+
 func (c *Cron) AddJob(job string) *Job {
 	return &Job{
 		Name: job,
+		c:    c,
 	}
 }
 func (j *Job) AddAction(action, spec string, f HandlerFunc) *Job {
 	j.c.cron.AddFunc(spec, func() {
-		ctx := context.Background()
+		ctx := j.c.newContext()
 		if err := j.c.chain.run(j.Name, action, f)(ctx); err != nil {
 			logrus.WithError(err).Error("")
 		}
@@ -55,13 +65,20 @@ func (j *Job) AddAction(action, spec string, f HandlerFunc) *Job {
 }
 func (c *Cron) AddAction(action, spec string, f HandlerFunc) {
 	c.cron.AddFunc(spec, func() {
-		ctx := context.Background()
+		ctx := c.newContext()
 		if err := c.chain.run(c.name, action, f)(ctx); err != nil {
 			logrus.WithError(err).Error("")
 		}
 	})
 }
 
+// newContext returns the context of a run, with a new ctxbase.ContextBase which starts a new trace.
+func (c *Cron) newContext() context.Context {
+	cb := ctxbase.New("", "", "")
+	cb.Baggage = c.baggage.Copy()
+	return cb.ToCtx(context.Background())
+}
+
 func (c *Cron) Start(address string) {
 	go c.cron.Start()
 
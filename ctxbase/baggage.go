@@ -0,0 +1,156 @@
+package ctxbase
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// W3C Baggage header, see https://www.w3.org/TR/baggage/
+const HeaderBaggage = "baggage"
+
+// Limits of the baggage. Members beyond the limits are dropped when the baggage is parsed or encoded.
+var (
+	MaxBaggageMembers = 64
+	MaxBaggageBytes   = 8192
+)
+
+var (
+	ErrInvalidBaggageKey = errors.New("invalid baggage key")
+	ErrBaggageTooLarge   = errors.New("baggage too large")
+)
+
+// Baggage carries small key/value items (e.g. tenant, channel, store ID) across services.
+// Properties of the W3C format are not supported and dropped.
+type Baggage map[string]string
+
+// ParseBaggage parses a baggage header like "tenant=pangpang,store_id=123".
+// Invalid members are skipped. If the header exceeds the limits, the members that fit are returned with ErrBaggageTooLarge.
+func ParseBaggage(s string) (Baggage, error) {
+	b := Baggage{}
+	size := 0
+	for _, member := range strings.Split(s, ",") {
+		// drop properties
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i]
+		}
+		i := strings.IndexByte(member, '=')
+		if i < 0 {
+			continue
+		}
+		key, raw := strings.TrimSpace(member[:i]), strings.TrimSpace(member[i+1:])
+		value, err := url.PathUnescape(raw)
+		if err != nil || !isToken(key) {
+			continue
+		}
+		if _, ok := b[key]; !ok {
+			size += memberSize(len(b), key, raw)
+			if len(b) >= MaxBaggageMembers || size > MaxBaggageBytes {
+				return b, ErrBaggageTooLarge
+			}
+		}
+		b[key] = value
+	}
+	return b, nil
+}
+
+func (b Baggage) Get(key string) string {
+	return b[key]
+}
+
+// Set adds or replaces a member, and returns ErrBaggageTooLarge if the baggage would exceed the limits.
+func (b Baggage) Set(key, value string) error {
+	if !isToken(key) {
+		return ErrInvalidBaggageKey
+	}
+	old, ok := b[key]
+	b[key] = value
+	if len(b) > MaxBaggageMembers || len(b.String()) < b.size() {
+		if ok {
+			b[key] = old
+		} else {
+			delete(b, key)
+		}
+		return ErrBaggageTooLarge
+	}
+	return nil
+}
+
+func (b Baggage) Delete(key string) {
+	delete(b, key)
+}
+
+// Copy returns a copy of b, which can be changed without affecting b.
+func (b Baggage) Copy() Baggage {
+	if b == nil {
+		return nil
+	}
+	c := make(Baggage, len(b))
+	for k, v := range b {
+		c[k] = v
+	}
+	return c
+}
+
+// String encodes b for the baggage header. Members are sorted by key, and members beyond the limits are dropped.
+func (b Baggage) String() string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	s := new(strings.Builder)
+	for i, k := range keys {
+		if i >= MaxBaggageMembers {
+			break
+		}
+		value := escapeBaggageValue(b[k])
+		if s.Len()+memberSize(i, k, value) > MaxBaggageBytes {
+			break
+		}
+		if i > 0 {
+			s.WriteString(",")
+		}
+		s.WriteString(k + "=" + value)
+	}
+	return s.String()
+}
+
+// size returns the length of the encoded baggage without the limits.
+func (b Baggage) size() int {
+	size, i := 0, 0
+	for k, v := range b {
+		size += memberSize(i, k, escapeBaggageValue(v))
+		i++
+	}
+	return size
+}
+
+// memberSize returns the encoded length of "key=value" with the comma before it.
+func memberSize(index int, key, value string) int {
+	size := len(key) + 1 + len(value)
+	if index > 0 {
+		size++
+	}
+	return size
+}
+
+func escapeBaggageValue(v string) string {
+	return strings.Replace(url.QueryEscape(v), "+", "%20", -1)
+}
+
+// isToken reports whether s is a token of RFC 7230.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package ctxbase_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestParseBaggage(t *testing.T) {
+	b, err := ctxbase.ParseBaggage("tenant=pangpang, store_id=123;prop=1,name=hello%20world,invalid,(bad)=1")
+	test.Ok(t, err)
+	test.Equals(t, ctxbase.Baggage{"tenant": "pangpang", "store_id": "123", "name": "hello world"}, b)
+	test.Equals(t, "name=hello%20world,store_id=123,tenant=pangpang", b.String())
+
+	b, err = ctxbase.ParseBaggage("")
+	test.Ok(t, err)
+	test.Equals(t, 0, len(b))
+}
+
+func TestBaggageLimits(t *testing.T) {
+	b := ctxbase.Baggage{}
+	for i := 0; i < ctxbase.MaxBaggageMembers; i++ {
+		test.Ok(t, b.Set("k"+strconv.Itoa(i), "v"))
+	}
+	test.Equals(t, ctxbase.ErrBaggageTooLarge, b.Set("one_more", "v"))
+	test.Equals(t, ctxbase.MaxBaggageMembers, len(b))
+	// replacing a member is fine
+	test.Ok(t, b.Set("k0", "v2"))
+
+	_, err := ctxbase.ParseBaggage(b.String() + ",one_more=v")
+	test.Equals(t, ctxbase.ErrBaggageTooLarge, err)
+
+	b = ctxbase.Baggage{}
+	long := string(make([]byte, ctxbase.MaxBaggageBytes))
+	test.Equals(t, ctxbase.ErrBaggageTooLarge, b.Set("long", long))
+	test.Equals(t, 0, len(b))
+
+	test.Equals(t, ctxbase.ErrInvalidBaggageKey, b.Set("a b", "v"))
+}
+
+func TestInjectExtract(t *testing.T) {
+	cb := ctxbase.New("req-1", "", "")
+	test.Ok(t, cb.Baggage.Set("tenant", "pangpang"))
+
+	header := http.Header{}
+	cb.Inject(header)
+	test.Equals(t, "req-1", header.Get(ctxbase.HeaderXRequestID))
+	test.Equals(t, cb.ActionID, header.Get(ctxbase.HeaderXActionID))
+	test.Equals(t, cb.Traceparent(), header.Get(ctxbase.HeaderTraceparent))
+	test.Equals(t, "tenant=pangpang", header.Get(ctxbase.HeaderBaggage))
+
+	next := ctxbase.Extract(header)
+	test.Equals(t, "req-1", next.RequestID)
+	test.Equals(t, cb.TraceID, next.TraceID)
+	test.Equals(t, cb.SpanID, next.ParentSpanID)
+	test.Equals(t, "pangpang", next.Baggage.Get("tenant"))
+
+	child := next.NewChild()
+	test.Ok(t, child.Baggage.Set("channel", "web"))
+	test.Equals(t, "", next.Baggage.Get("channel"))
+}
@@ -2,21 +2,52 @@ package ctxbase
 
 import (
 	"context"
-
-	uuid "github.com/satori/go.uuid"
 )
 
+// ContextBaseName is the old context key of ContextBase, which is still set by ToCtx and looked up by FromCtx.
+//
+// Deprecated: use FromCtx and ToCtx.
 const ContextBaseName = "ContextBase"
 
+type contextKey struct{}
+
+const (
+	HeaderXRequestID = "X-Request-ID"
+	HeaderXActionID  = "X-Action-ID"
+)
+
 type ContextBase struct {
 	RequestID string
 	ActionID  string
+
+	// W3C trace context of the current action
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Sampled      bool
+	TraceState   string
+
+	Baggage Baggage
+}
+
+// Carrier is where a ContextBase is injected into and extracted from, e.g. http.Header or kafka message headers.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+func (c *ContextBase) ToCtx(ctx context.Context) context.Context {
+	// the old key is still set for code that reads it directly
+	return context.WithValue(context.WithValue(ctx, ContextBaseName, c), contextKey{}, c)
 }
 
 func FromCtx(ctx context.Context) *ContextBase {
 	if ctx == nil {
 		return nil
 	}
+	if c, ok := ctx.Value(contextKey{}).(*ContextBase); ok {
+		return c
+	}
 	c, ok := ctx.Value(ContextBaseName).(*ContextBase)
 	if !ok {
 		return nil
@@ -24,10 +55,76 @@ func FromCtx(ctx context.Context) *ContextBase {
 	return c
 }
 
-func NewID() string {
-	u, err := uuid.NewV1()
-	if err != nil {
+// New returns a ContextBase for an incoming request.
+// The trace is continued from traceparent/tracestate if traceparent is valid, otherwise a new trace is started.
+// A new span ID is generated for the action, and requestID falls back to the trace ID if it is empty.
+func New(requestID, traceparent, tracestate string) *ContextBase {
+	cb := ContextBase{
+		ActionID: NewID(),
+		SpanID:   NewSpanID(),
+		Baggage:  Baggage{},
+	}
+	if tp, err := ParseTraceparent(traceparent); err == nil {
+		cb.TraceID = tp.TraceID
+		cb.ParentSpanID = tp.SpanID
+		cb.Sampled = tp.Sampled
+		cb.TraceState = tracestate
+	} else {
+		cb.TraceID = NewTraceID()
+		cb.Sampled = true
+	}
+
+	cb.RequestID = requestID
+	if cb.RequestID == "" {
+		cb.RequestID = cb.TraceID
+	}
+	return &cb
+}
+
+// Extract returns a ContextBase for an incoming request or message, see New.
+// The baggage is extracted as well, and dropped if it's invalid.
+func Extract(carrier Carrier) *ContextBase {
+	cb := New(carrier.Get(HeaderXRequestID), carrier.Get(HeaderTraceparent), carrier.Get(HeaderTracestate))
+	if s := carrier.Get(HeaderBaggage); s != "" {
+		cb.Baggage, _ = ParseBaggage(s)
+	}
+	return cb
+}
+
+// Inject sets the request ID, action ID, trace context and baggage of c to an outgoing request or message.
+func (c *ContextBase) Inject(carrier Carrier) {
+	if c.RequestID != "" {
+		carrier.Set(HeaderXRequestID, c.RequestID)
+	}
+	if c.ActionID != "" {
+		carrier.Set(HeaderXActionID, c.ActionID)
+	}
+	if traceparent := c.Traceparent(); traceparent != "" {
+		carrier.Set(HeaderTraceparent, traceparent)
+		if c.TraceState != "" {
+			carrier.Set(HeaderTracestate, c.TraceState)
+		}
+	}
+	if baggage := c.Baggage.String(); baggage != "" {
+		carrier.Set(HeaderBaggage, baggage)
+	}
+}
+
+// NewChild returns a ContextBase for a new action in the same request and trace, with a new action ID and span ID.
+func (c *ContextBase) NewChild() *ContextBase {
+	child := *c
+	child.ActionID = NewID()
+	child.ParentSpanID = c.SpanID
+	child.SpanID = NewSpanID()
+	child.Baggage = c.Baggage.Copy()
+	return &child
+}
+
+// Traceparent returns the traceparent header for outgoing requests, in which the current span is the parent.
+// It returns an empty string if there is no trace.
+func (c *ContextBase) Traceparent() string {
+	if c.TraceID == "" || c.SpanID == "" {
 		return ""
 	}
-	return u.String()
+	return Traceparent{TraceID: c.TraceID, SpanID: c.SpanID, Sampled: c.Sampled}.String()
 }
@@ -0,0 +1,23 @@
+package ctxbase_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestFromCtx(t *testing.T) {
+	cb := ctxbase.New("req-1", "", "")
+	test.Equals(t, cb, ctxbase.FromCtx(cb.ToCtx(context.Background())))
+
+	// the old key is still set and supported
+	test.Equals(t, cb, cb.ToCtx(context.Background()).Value(ctxbase.ContextBaseName))
+	ctx := context.WithValue(context.Background(), ctxbase.ContextBaseName, cb)
+	test.Equals(t, cb, ctxbase.FromCtx(ctx))
+
+	var nilCb *ctxbase.ContextBase
+	test.Equals(t, nilCb, ctxbase.FromCtx(context.Background()))
+	test.Equals(t, nilCb, ctxbase.FromCtx(context.WithValue(context.Background(), "ContextBase", "not a context base")))
+}
@@ -0,0 +1,326 @@
+package ctxbase
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Names of the built-in ID generators.
+const (
+	IDGeneratorUUIDv1    = "uuidv1"
+	IDGeneratorUUIDv4    = "uuidv4"
+	IDGeneratorULID      = "ulid"
+	IDGeneratorSnowflake = "snowflake"
+)
+
+var (
+	ErrUnknownIDGenerator = errors.New("unknown id generator")
+	ErrInvalidWorkerID    = errors.New("snowflake worker id must be between 0 and 1023")
+	ErrClockBackwards     = errors.New("clock moved backwards")
+)
+
+// IDGenerator generates unique IDs, e.g. for request IDs, action IDs and primary keys.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+type IDGeneratorFunc func() (string, error)
+
+func (f IDGeneratorFunc) NewID() (string, error) {
+	return f()
+}
+
+var idGenerators = struct {
+	sync.RWMutex
+	m       map[string]IDGenerator
+	current IDGenerator
+}{m: map[string]IDGenerator{}}
+
+func init() {
+	RegisterIDGenerator(IDGeneratorUUIDv1, IDGeneratorFunc(func() (string, error) {
+		u, err := uuid.NewV1()
+		return u.String(), err
+	}))
+	RegisterIDGenerator(IDGeneratorUUIDv4, IDGeneratorFunc(func() (string, error) {
+		u, err := uuid.NewV4()
+		return u.String(), err
+	}))
+	RegisterIDGenerator(IDGeneratorULID, &ulidGenerator{})
+	RegisterIDGenerator(IDGeneratorSnowflake, IDGeneratorFunc(func() (string, error) {
+		return DefaultSnowflake().NewID()
+	}))
+	idGenerators.current = idGenerators.m[IDGeneratorUUIDv4]
+}
+
+// RegisterIDGenerator adds or replaces an ID generator.
+func RegisterIDGenerator(name string, g IDGenerator) {
+	idGenerators.Lock()
+	defer idGenerators.Unlock()
+	idGenerators.m[strings.ToLower(name)] = g
+}
+
+func LookupIDGenerator(name string) (IDGenerator, error) {
+	idGenerators.RLock()
+	defer idGenerators.RUnlock()
+	g, ok := idGenerators.m[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIDGenerator, name)
+	}
+	return g, nil
+}
+
+// UseIDGenerator sets the registered generator used by NewID and GenerateID. The default is uuidv4.
+func UseIDGenerator(name string) error {
+	g, err := LookupIDGenerator(name)
+	if err != nil {
+		return err
+	}
+	idGenerators.Lock()
+	defer idGenerators.Unlock()
+	idGenerators.current = g
+	return nil
+}
+
+// IDConfig configures ID generation, and is typically a part of the service config.
+type IDConfig struct {
+	Generator string // uuidv4 (default), uuidv1, ulid, snowflake or a registered generator
+	WorkerID  *int64 // worker ID of snowflake, defaults to a hash of the hostname
+}
+
+func SetIDConfig(c IDConfig) error {
+	if c.WorkerID != nil {
+		s, err := NewSnowflake(*c.WorkerID)
+		if err != nil {
+			return err
+		}
+		SetDefaultSnowflake(s)
+	}
+	if c.Generator == "" {
+		c.Generator = IDGeneratorUUIDv4
+	}
+	return UseIDGenerator(c.Generator)
+}
+
+// GenerateID returns a new ID from the current generator.
+func GenerateID() (string, error) {
+	idGenerators.RLock()
+	g := idGenerators.current
+	idGenerators.RUnlock()
+	return g.NewID()
+}
+
+// NewID is like GenerateID, for callers which can't handle an error, e.g. request IDs of middlewares.
+// If the current generator fails (e.g. snowflake with ErrClockBackwards), the error is logged and a UUIDv4 is returned instead.
+func NewID() string {
+	id, err := GenerateID()
+	if err == nil {
+		return id
+	}
+	log.Printf("ctxbase: failed to generate id, uuidv4 is used instead: %v", err)
+	u, err := uuid.NewV4()
+	if err != nil {
+		log.Printf("ctxbase: failed to generate uuidv4: %v", err)
+		return ""
+	}
+	return u.String()
+}
+
+// Snowflake generates time-ordered int64 IDs: 41 bits of milliseconds since SnowflakeEpoch, 10 bits of worker ID and 12 bits of sequence.
+// Every process generating IDs for the same table needs a different worker ID.
+type Snowflake struct {
+	mu       sync.Mutex
+	workerID int64
+	lastMs   int64
+	sequence int64
+	now      func() time.Time
+	// behind reports whether ForceNextID is generating IDs from lastMs, because the clock is behind it
+	behind bool
+}
+
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	snowflakeWorkerBits   = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxWorkerID  = 1<<snowflakeWorkerBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+	// the clock is waited for if it moves backwards less than this
+	snowflakeMaxClockBackwards = 10 * time.Millisecond
+)
+
+// NewSnowflake returns a Snowflake with workerID. A negative workerID uses WorkerIDFromHostname.
+func NewSnowflake(workerID int64) (*Snowflake, error) {
+	if workerID < 0 {
+		workerID = WorkerIDFromHostname()
+	}
+	if workerID > snowflakeMaxWorkerID {
+		return nil, ErrInvalidWorkerID
+	}
+	return &Snowflake{workerID: workerID, now: time.Now}, nil
+}
+
+// WorkerIDFromHostname returns a worker ID from the hash of the hostname, e.g. the pod name.
+// Different hosts may get the same worker ID, so set it in the config if that can't be tolerated.
+func WorkerIDFromHostname() int64 {
+	hostname, _ := os.Hostname()
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	return int64(h.Sum32() % (snowflakeMaxWorkerID + 1))
+}
+
+var defaultSnowflake struct {
+	sync.Mutex
+	s *Snowflake
+}
+
+// DefaultSnowflake returns the Snowflake used by the snowflake generator, which uses WorkerIDFromHostname unless SetDefaultSnowflake is called.
+func DefaultSnowflake() *Snowflake {
+	defaultSnowflake.Lock()
+	defer defaultSnowflake.Unlock()
+	if defaultSnowflake.s == nil {
+		defaultSnowflake.s, _ = NewSnowflake(-1)
+	}
+	return defaultSnowflake.s
+}
+
+func SetDefaultSnowflake(s *Snowflake) {
+	defaultSnowflake.Lock()
+	defer defaultSnowflake.Unlock()
+	defaultSnowflake.s = s
+}
+
+func (s *Snowflake) WorkerID() int64 {
+	return s.workerID
+}
+
+// NextID returns a new ID. It waits for the next millisecond if the sequence runs out,
+// and returns ErrClockBackwards if the clock moved backwards too much.
+func (s *Snowflake) NextID() (int64, error) {
+	return s.next(false)
+}
+
+// ForceNextID is like NextID for callers which can't handle an error, e.g. xorm's BeforeInsert.
+// If the clock moved backwards too much, the error is logged, and IDs are generated from the last timestamp
+// (incremented when the sequence runs out) until the clock catches up, so they stay unique and increasing in the process.
+// IDs generated by another process with the same worker ID in the meantime (e.g. after a restart) may collide.
+func (s *Snowflake) ForceNextID() int64 {
+	id, _ := s.next(true)
+	return id
+}
+
+func (s *Snowflake) next(force bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.millis()
+	behind := false
+	if ms < s.lastMs {
+		switch {
+		case time.Duration(s.lastMs-ms)*time.Millisecond <= snowflakeMaxClockBackwards:
+			for ms < s.lastMs {
+				time.Sleep(time.Duration(s.lastMs-ms) * time.Millisecond)
+				ms = s.millis()
+			}
+		case !force:
+			return 0, fmt.Errorf("%w by %dms", ErrClockBackwards, s.lastMs-ms)
+		default:
+			if !s.behind {
+				log.Printf("ctxbase: snowflake %v by %dms, ids are generated from the last timestamp", ErrClockBackwards, s.lastMs-ms)
+			}
+			ms, behind = s.lastMs, true
+		}
+	}
+	s.behind = behind
+	if ms == s.lastMs {
+		s.sequence = (s.sequence + 1) & snowflakeMaxSequence
+		if s.sequence == 0 {
+			if behind {
+				ms++
+			}
+			for ms <= s.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = s.millis()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastMs = ms
+
+	return ms<<(snowflakeWorkerBits+snowflakeSequenceBits) | s.workerID<<snowflakeSequenceBits | s.sequence, nil
+}
+
+// NewID returns NextID in decimal.
+func (s *Snowflake) NewID() (string, error) {
+	id, err := s.NextID()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (s *Snowflake) millis() int64 {
+	return s.now().Sub(SnowflakeEpoch).Nanoseconds() / int64(time.Millisecond)
+}
+
+// ulidGenerator generates ULIDs (https://github.com/ulid/spec).
+// IDs generated in the same millisecond are monotonic, by incrementing the random part.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ulidGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms != g.lastMs || !increment(g.entropy[:]) {
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			return "", err
+		}
+		g.lastMs = ms
+	}
+
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	copy(b[6:], g.entropy[:])
+	return encodeULID(b), nil
+}
+
+// increment adds 1 to b in big-endian, and reports false on overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes 128 bits into 26 characters of Crockford's base32.
+func encodeULID(b [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
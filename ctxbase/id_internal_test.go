@@ -0,0 +1,48 @@
+package ctxbase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestSnowflakeClockBackwards(t *testing.T) {
+	s, err := NewSnowflake(1)
+	test.Ok(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	last, err := s.NextID()
+	test.Ok(t, err)
+
+	now = now.Add(-time.Second)
+	_, err = s.NextID()
+	test.Assert(t, errors.Is(err, ErrClockBackwards), "expected ErrClockBackwards, got %v", err)
+
+	// more than the sequence of a millisecond
+	for i := 0; i < snowflakeMaxSequence+10; i++ {
+		id := s.ForceNextID()
+		test.Assert(t, id > last, "snowflake ids should increase")
+		last = id
+	}
+
+	now = now.Add(2 * time.Second)
+	id, err := s.NextID()
+	test.Ok(t, err)
+	test.Assert(t, id > last, "snowflake ids should increase after the clock catches up")
+}
+
+func TestNewIDFallback(t *testing.T) {
+	defer UseIDGenerator(IDGeneratorUUIDv4)
+
+	RegisterIDGenerator("broken", IDGeneratorFunc(func() (string, error) {
+		return "", ErrClockBackwards
+	}))
+	test.Ok(t, UseIDGenerator("broken"))
+
+	_, err := GenerateID()
+	test.Equals(t, ErrClockBackwards, err)
+	test.Equals(t, 36, len(NewID()))
+}
@@ -0,0 +1,83 @@
+package ctxbase_test
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestIDGenerators(t *testing.T) {
+	patterns := map[string]*regexp.Regexp{
+		ctxbase.IDGeneratorUUIDv1:    regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-1[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`),
+		ctxbase.IDGeneratorUUIDv4:    regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`),
+		ctxbase.IDGeneratorULID:      regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+		ctxbase.IDGeneratorSnowflake: regexp.MustCompile(`^[1-9][0-9]*$`),
+	}
+	for name, pattern := range patterns {
+		t.Run(name, func(t *testing.T) {
+			g, err := ctxbase.LookupIDGenerator(name)
+			test.Ok(t, err)
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				id, err := g.NewID()
+				test.Ok(t, err)
+				test.Assert(t, pattern.MatchString(id), "invalid id: %s", id)
+				test.Assert(t, !seen[id], "duplicated id: %s", id)
+				seen[id] = true
+			}
+		})
+	}
+
+	_, err := ctxbase.LookupIDGenerator("unknown")
+	test.Assert(t, errors.Is(err, ctxbase.ErrUnknownIDGenerator), "unexpected error: %v", err)
+}
+
+func TestULIDIsSortable(t *testing.T) {
+	g, err := ctxbase.LookupIDGenerator(ctxbase.IDGeneratorULID)
+	test.Ok(t, err)
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i], err = g.NewID()
+		test.Ok(t, err)
+	}
+	test.Assert(t, sort.StringsAreSorted(ids), "ulids should be monotonic")
+}
+
+func TestSnowflake(t *testing.T) {
+	s, err := ctxbase.NewSnowflake(5)
+	test.Ok(t, err)
+	test.Equals(t, int64(5), s.WorkerID())
+
+	var last int64
+	for i := 0; i < 10000; i++ {
+		id, err := s.NextID()
+		test.Ok(t, err)
+		test.Assert(t, id > last, "snowflake ids should increase")
+		test.Equals(t, int64(5), id>>12&1023)
+		last = id
+	}
+
+	_, err = ctxbase.NewSnowflake(1024)
+	test.Equals(t, ctxbase.ErrInvalidWorkerID, err)
+
+	s, err = ctxbase.NewSnowflake(-1)
+	test.Ok(t, err)
+	test.Equals(t, ctxbase.WorkerIDFromHostname(), s.WorkerID())
+}
+
+func TestSetIDConfig(t *testing.T) {
+	defer ctxbase.UseIDGenerator(ctxbase.IDGeneratorUUIDv4)
+
+	workerID := int64(7)
+	test.Ok(t, ctxbase.SetIDConfig(ctxbase.IDConfig{Generator: "snowflake", WorkerID: &workerID}))
+	test.Equals(t, int64(7), ctxbase.DefaultSnowflake().WorkerID())
+	id, err := ctxbase.GenerateID()
+	test.Ok(t, err)
+	test.Assert(t, regexp.MustCompile(`^[0-9]+$`).MatchString(id), "unexpected id: %s", id)
+
+	test.Assert(t, ctxbase.SetIDConfig(ctxbase.IDConfig{Generator: "unknown"}) != nil, "unknown generator should fail")
+}
@@ -0,0 +1,102 @@
+package ctxbase
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+const (
+	traceparentVersion = "00"
+	flagSampled        = 0x01
+)
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// Traceparent is the parsed traceparent header.
+type Traceparent struct {
+	TraceID string // 32 lowercase hex characters
+	SpanID  string // 16 lowercase hex characters, the parent span of the receiver
+	Sampled bool
+}
+
+// ParseTraceparent parses a traceparent header like "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+// Headers of future versions are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(s string) (Traceparent, error) {
+	s = strings.TrimSpace(s)
+	// version(2) - trace-id(32) - parent-id(16) - flags(2)
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return Traceparent{}, ErrInvalidTraceparent
+	}
+	version, traceID, spanID, flags := s[:2], s[3:35], s[36:52], s[53:55]
+	if !isHex(version) || version == "ff" ||
+		version == traceparentVersion && len(s) != 55 ||
+		version != traceparentVersion && len(s) > 55 && s[55] != '-' {
+		return Traceparent{}, ErrInvalidTraceparent
+	}
+	if !isHex(traceID) || isZero(traceID) || !isHex(spanID) || isZero(spanID) || !isHex(flags) {
+		return Traceparent{}, ErrInvalidTraceparent
+	}
+
+	f, _ := hex.DecodeString(flags)
+	return Traceparent{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: f[0]&flagSampled != 0,
+	}, nil
+}
+
+func (t Traceparent) String() string {
+	flags := 0
+	if t.Sampled {
+		flags |= flagSampled
+	}
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, t.TraceID, t.SpanID, flags)
+}
+
+// NewTraceID returns a random 16-byte trace ID in hex.
+func NewTraceID() string {
+	return randomHex(16)
+}
+
+// NewSpanID returns a random 8-byte span ID in hex.
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		// all-zero IDs are invalid
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,70 @@
+package ctxbase_test
+
+import (
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tp, err := ctxbase.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	test.Ok(t, err)
+	test.Equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", tp.TraceID)
+	test.Equals(t, "00f067aa0ba902b7", tp.SpanID)
+	test.Equals(t, true, tp.Sampled)
+	test.Equals(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tp.String())
+
+	tp, err = ctxbase.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	test.Ok(t, err)
+	test.Equals(t, false, tp.Sampled)
+
+	// future versions may append fields
+	_, err = ctxbase.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc")
+	test.Ok(t, err)
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		_, err := ctxbase.ParseTraceparent(s)
+		test.Equals(t, ctxbase.ErrInvalidTraceparent, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Run("continue trace", func(t *testing.T) {
+		cb := ctxbase.New("req-1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "congo=t61rcWkgMzE")
+		test.Equals(t, "req-1", cb.RequestID)
+		test.Equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", cb.TraceID)
+		test.Equals(t, "00f067aa0ba902b7", cb.ParentSpanID)
+		test.Equals(t, 16, len(cb.SpanID))
+		test.Assert(t, cb.SpanID != cb.ParentSpanID, "a new span should be generated")
+		test.Equals(t, false, cb.Sampled)
+		test.Equals(t, "congo=t61rcWkgMzE", cb.TraceState)
+		test.Equals(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+cb.SpanID+"-00", cb.Traceparent())
+	})
+	t.Run("new trace", func(t *testing.T) {
+		cb := ctxbase.New("", "invalid", "congo=t61rcWkgMzE")
+		test.Equals(t, 32, len(cb.TraceID))
+		test.Equals(t, cb.TraceID, cb.RequestID)
+		test.Equals(t, "", cb.ParentSpanID)
+		test.Equals(t, "", cb.TraceState)
+		test.Equals(t, true, cb.Sampled)
+	})
+	t.Run("child", func(t *testing.T) {
+		cb := ctxbase.New("", "", "")
+		child := cb.NewChild()
+		test.Equals(t, cb.TraceID, child.TraceID)
+		test.Equals(t, cb.RequestID, child.RequestID)
+		test.Equals(t, cb.SpanID, child.ParentSpanID)
+		test.Assert(t, cb.ActionID != child.ActionID, "a new action ID should be generated")
+		test.Assert(t, cb.SpanID != child.SpanID, "a new span ID should be generated")
+	})
+}
@@ -0,0 +1,461 @@
+package ctxdb
+
+import (
+	"context"
+	stdlog "log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pangpanglabs/goutils/behaviorlog"
+	"github.com/pangpanglabs/goutils/kafka"
+	"xorm.io/xorm"
+	"xorm.io/xorm/contexts"
+	"xorm.io/xorm/schemas"
+)
+
+// AuditMaxRows is the maximum number of rows read before an update or a delete.
+const AuditMaxRows = 1000
+
+// Actions of audit events.
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditEvent is a change of rows of an audited table.
+//
+// After has the inserted values, or the values set by an update. Values which are not args of the SQL
+// (e.g. "count = count + 1") are not captured.
+//
+// Updates and deletes of a single table by sessions of ContextDB.NewSession have an event per row: the rows matched
+// by the WHERE clause are read before the SQL in its transaction (locked by FOR UPDATE on MySQL and PostgreSQL),
+// and Before has the values of the changed columns, or all of them for a delete.
+// Otherwise (e.g. joins, or more than AuditMaxRows rows) an event has the columns compared by "column = ?" in the WHERE clause.
+type AuditEvent struct {
+	Service      string                 `json:"service,omitempty"`
+	Table        string                 `json:"table"`
+	Action       string                 `json:"action"`
+	PrimaryKey   map[string]interface{} `json:"primaryKey,omitempty"`
+	Columns      []string               `json:"columns,omitempty"`
+	Before       map[string]interface{} `json:"before,omitempty"`
+	After        map[string]interface{} `json:"after,omitempty"`
+	RowsAffected int64                  `json:"rowsAffected,omitempty"`
+	Username     string                 `json:"username,omitempty"`
+	TenantCode   string                 `json:"tenantCode,omitempty"`
+	RequestID    string                 `json:"requestId,omitempty"`
+	ActionID     string                 `json:"actionId,omitempty"`
+	Timestamp    time.Time              `json:"timestamp"`
+}
+
+// AuditSink is where audit events are written to.
+type AuditSink interface {
+	Write(event *AuditEvent) error
+}
+
+type AuditSinkFunc func(event *AuditEvent) error
+
+func (f AuditSinkFunc) Write(event *AuditEvent) error {
+	return f(event)
+}
+
+// KafkaAuditSink sends audit events to the topic of producer.
+func KafkaAuditSink(producer *kafka.Producer) AuditSink {
+	return AuditSinkFunc(func(event *AuditEvent) error {
+		return producer.Send(event)
+	})
+}
+
+// Audit writes the changes of the tables of beans to sink, e.g. Audit(sink, new(Order), new(OrderItem)).
+// Changes in a transaction of a session by NewSession are written after it's committed, and dropped if it's rolled back.
+func Audit(sink AuditSink, beans ...interface{}) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.auditSink = sink
+		db.auditBeans = append(db.auditBeans, beans...)
+	}
+}
+
+type auditKey struct{}
+
+// auditSession keeps the audit events of the transaction of a session until it's committed.
+type auditSession struct {
+	session    *xorm.Session
+	mu         sync.Mutex
+	inTx       bool
+	events     []*AuditEvent
+	savepoints []auditSavepoint
+	// before are the rows read before the SQL being executed
+	before *auditRows
+}
+
+// auditRows are the rows matched by an update or a delete before it's executed.
+type auditRows struct {
+	sql  string
+	rows []map[string]interface{}
+}
+
+type auditSavepoint struct {
+	name   string
+	events int
+}
+
+type auditHook struct {
+	service string
+	// tables maps tables to their primary keys
+	tables map[string][]string
+	sink   AuditSink
+}
+
+var _ contexts.Hook = &auditHook{}
+
+func (h *auditHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	var s *auditSession
+	if c.Ctx != nil {
+		s, _ = c.Ctx.Value(auditKey{}).(*auditSession)
+	}
+	if s == nil || s.session == nil {
+		return c.Ctx, nil
+	}
+	s.mu.Lock()
+	inTx := s.inTx
+	s.mu.Unlock()
+	// the rows are read by the session, whose hooks lock s
+	before := h.before(c, s.session, inTx)
+	s.mu.Lock()
+	s.before = before
+	s.mu.Unlock()
+	return c.Ctx, nil
+}
+
+// before reads the rows matched by an update or a delete of an audited table by session, in its transaction if inTx.
+func (h *auditHook) before(c *contexts.ContextHook, session *xorm.Session, inTx bool) *auditRows {
+	table, _ := parseSQLArgs(c.SQL)
+	if _, ok := h.tables[table]; !ok {
+		return nil
+	}
+	sql, args, ok := preImageSQL(c.SQL, c.Args)
+	if !ok {
+		return nil
+	}
+	switch session.Engine().Dialect().URI().DBType {
+	case schemas.MYSQL, schemas.POSTGRES:
+		sql += " LIMIT " + strconv.Itoa(AuditMaxRows+1)
+		if inTx {
+			sql += " FOR UPDATE"
+		}
+	case schemas.SQLITE:
+		sql += " LIMIT " + strconv.Itoa(AuditMaxRows+1)
+	}
+	// the statement of the session has been built, so it can run another SQL; the session runs it in its transaction
+	rows, err := session.SQL(sql, args...).QueryInterface()
+	if err != nil {
+		stdlog.Println("ctxdb: failed to read rows before audit:", err)
+		return nil
+	}
+	if len(rows) > AuditMaxRows {
+		return nil
+	}
+	before := &auditRows{sql: c.SQL, rows: make([]map[string]interface{}, 0, len(rows))}
+	for _, values := range rows {
+		row := make(map[string]interface{}, len(values))
+		for column, value := range values {
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			row[strings.ToLower(column)] = value
+		}
+		before.rows = append(before.rows, row)
+	}
+	return before
+}
+
+// preImageSQL returns a SELECT of the rows matched by an UPDATE or a DELETE of a single table, and its args,
+// or false if sql isn't one.
+func preImageSQL(sql string, args []interface{}) (string, []interface{}, bool) {
+	tokens := sqlTokenPattern.FindAllStringIndex(sql, -1)
+	word := func(i int) string {
+		if i < len(tokens) {
+			return strings.ToUpper(sql[tokens[i][0]:tokens[i][1]])
+		}
+		return ""
+	}
+	var table, next int
+	switch word(0) {
+	case "UPDATE":
+		table, next = 1, 2
+		if word(next) != "SET" {
+			return "", nil, false
+		}
+	case "DELETE":
+		if word(1) != "FROM" {
+			return "", nil, false
+		}
+		table, next = 2, 3
+		if word(next) != "WHERE" && word(next) != "" {
+			return "", nil, false
+		}
+	default:
+		return "", nil, false
+	}
+	if table >= len(tokens) {
+		return "", nil, false
+	}
+
+	depth, placeholders := 0, 0
+	for i := next; i < len(tokens); i++ {
+		switch token := word(i); {
+		case token == "$":
+			// placeholders like $1 can't be renumbered
+			return "", nil, false
+		case token == "(":
+			depth++
+		case token == ")":
+			depth--
+		case token == "?":
+			placeholders++
+		case token == "WHERE" && depth == 0:
+			if placeholders > len(args) {
+				return "", nil, false
+			}
+			return "SELECT * FROM " + sql[tokens[table][0]:tokens[table][1]] + " WHERE" + sql[tokens[i][1]:], args[placeholders:], true
+		}
+	}
+	return "SELECT * FROM " + sql[tokens[table][0]:tokens[table][1]], nil, true
+}
+
+func (h *auditHook) AfterProcess(c *contexts.ContextHook) error {
+	var s *auditSession
+	if c.Ctx != nil {
+		s, _ = c.Ctx.Value(auditKey{}).(*auditSession)
+	}
+	if s == nil {
+		// sessions not created by NewSession are written at once
+		if c.Err == nil {
+			h.write(h.events(c, nil))
+		}
+		return nil
+	}
+
+	sql := strings.ToUpper(strings.TrimSpace(c.SQL))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case sql == "BEGIN TRANSACTION":
+		s.inTx, s.events, s.savepoints = c.Err == nil, nil, nil
+	case sql == "COMMIT":
+		if c.Err == nil {
+			h.write(s.events)
+		}
+		s.inTx, s.events, s.savepoints = false, nil, nil
+	case sql == "ROLLBACK":
+		s.inTx, s.events, s.savepoints = false, nil, nil
+	case c.Err != nil:
+	case strings.HasPrefix(sql, "SAVEPOINT "):
+		s.savepoints = append(s.savepoints, auditSavepoint{strings.TrimPrefix(sql, "SAVEPOINT "), len(s.events)})
+	case strings.HasPrefix(sql, "ROLLBACK TO SAVEPOINT "), strings.HasPrefix(sql, "RELEASE SAVEPOINT "):
+		name := sql[strings.LastIndexByte(sql, ' ')+1:]
+		for i := len(s.savepoints) - 1; i >= 0; i-- {
+			if s.savepoints[i].name == name {
+				if strings.HasPrefix(sql, "ROLLBACK") {
+					s.events = s.events[:s.savepoints[i].events]
+				}
+				s.savepoints = s.savepoints[:i]
+				break
+			}
+		}
+	default:
+		before := s.before
+		s.before = nil
+		if before != nil && before.sql != c.SQL {
+			before = nil
+		}
+		events := h.events(c, before)
+		if s.inTx {
+			s.events = append(s.events, events...)
+		} else {
+			h.write(events)
+		}
+	}
+	return nil
+}
+
+func (h *auditHook) write(events []*AuditEvent) {
+	for _, event := range events {
+		if err := h.sink.Write(event); err != nil {
+			stdlog.Println("ctxdb: failed to write audit event:", err)
+		}
+	}
+}
+
+// events returns the audit events of an insert, update or delete of an audited table.
+// before are the rows matched by an update or a delete, if they are read.
+func (h *auditHook) events(c *contexts.ContextHook, before *auditRows) []*AuditEvent {
+	table, columns := parseSQLArgs(c.SQL)
+	primaryKey, ok := h.tables[table]
+	if !ok {
+		return nil
+	}
+	var action string
+	switch keyword := strings.ToUpper(firstWord(c.SQL)); keyword {
+	case "INSERT", "REPLACE":
+		action = AuditInsert
+	case "UPDATE":
+		action = AuditUpdate
+	case "DELETE":
+		action = AuditDelete
+	default:
+		return nil
+	}
+	var rowsAffected int64
+	if c.Result != nil {
+		if n, err := c.Result.RowsAffected(); err == nil {
+			if n == 0 {
+				return nil
+			}
+			rowsAffected = n
+		}
+	}
+
+	newEvent := func() *AuditEvent {
+		e := &AuditEvent{
+			Service:      h.service,
+			Table:        table,
+			Action:       action,
+			RowsAffected: rowsAffected,
+			Timestamp:    time.Now(),
+		}
+		e.RequestID, e.ActionID = ids(c.Ctx)
+		if c.Ctx != nil {
+			e.TenantCode = TenantFromCtx(c.Ctx)
+			if l := behaviorlog.FromCtx(c.Ctx); l != nil {
+				e.Username = l.Username
+			}
+		}
+		return e
+	}
+
+	if action == AuditInsert {
+		m := sqlInsertPattern.FindStringSubmatch(c.SQL)
+		if m == nil {
+			// the columns are unknown
+			return []*AuditEvent{newEvent()}
+		}
+		n := len(strings.Split(m[1], ","))
+		var events []*AuditEvent
+		for i := 0; i+n <= len(c.Args) && i+n <= len(columns); i += n {
+			e := newEvent()
+			e.RowsAffected = 1
+			e.After = map[string]interface{}{}
+			for j := i; j < i+n; j++ {
+				e.Columns = append(e.Columns, columns[j])
+				e.After[columns[j]] = c.Args[j]
+			}
+			e.PrimaryKey = pick(e.After, primaryKey)
+			events = append(events, e)
+		}
+		// auto-increment primary key of a single row
+		if len(events) == 1 && len(primaryKey) == 1 && len(events[0].PrimaryKey) == 0 && c.Result != nil {
+			if id, err := c.Result.LastInsertId(); err == nil {
+				events[0].PrimaryKey = map[string]interface{}{primaryKey[0]: id}
+			}
+		}
+		return events
+	}
+
+	// args before WHERE are set, and the others are conditions
+	where := placeholdersBefore(c.SQL, "where")
+	equals := placeholdersAfterEquals(c.SQL)
+	set := map[string]interface{}{}
+	conds := map[string][]interface{}{}
+	equalConds := map[string]interface{}{}
+	e := newEvent()
+	for i, column := range columns {
+		if i >= len(c.Args) || column == "" {
+			continue
+		}
+		switch {
+		case i < where && equals[i]:
+			if _, ok := set[column]; !ok {
+				e.Columns = append(e.Columns, column)
+			}
+			set[column] = c.Args[i]
+		case i >= where:
+			conds[column] = append(conds[column], c.Args[i])
+			if equals[i] {
+				equalConds[column] = c.Args[i]
+			}
+		}
+	}
+	for _, column := range primaryKey {
+		if values, ok := conds[column]; ok {
+			if e.PrimaryKey == nil {
+				e.PrimaryKey = map[string]interface{}{}
+			}
+			if len(values) == 1 {
+				e.PrimaryKey[column] = values[0]
+			} else {
+				e.PrimaryKey[column] = values
+			}
+		}
+	}
+	if before != nil && len(before.rows) != 0 {
+		// an event per row
+		var events []*AuditEvent
+		for _, row := range before.rows {
+			re := newEvent()
+			re.RowsAffected = 1
+			re.PrimaryKey = pick(row, primaryKey)
+			if action == AuditUpdate {
+				re.Columns, re.After, re.Before = e.Columns, set, pick(row, e.Columns)
+			} else {
+				re.Before = row
+			}
+			events = append(events, re)
+		}
+		return events
+	}
+	if action == AuditUpdate {
+		e.After = set
+		e.Before = pick(equalConds, e.Columns)
+	} else if len(equalConds) != 0 {
+		e.Before = equalConds
+	}
+	return []*AuditEvent{e}
+}
+
+func pick(m map[string]interface{}, keys []string) map[string]interface{} {
+	var picked map[string]interface{}
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			if picked == nil {
+				picked = map[string]interface{}{}
+			}
+			picked[k] = v
+		}
+	}
+	return picked
+}
+
+func firstWord(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if i := strings.IndexAny(sql, " \t\r\n"); i >= 0 {
+		return sql[:i]
+	}
+	return sql
+}
+
+// placeholdersAfterEquals reports which placeholders of sql follow "=", i.e. set or compared by "column = ?".
+func placeholdersAfterEquals(sql string) []bool {
+	var equals []bool
+	var prev, prev2 string
+	for _, token := range sqlTokenPattern.FindAllString(sql, -1) {
+		if token == "?" {
+			// not <=, >= or !=
+			equals = append(equals, prev == "=" && !(len(prev2) == 1 && strings.Contains("<>!", prev2)))
+		}
+		prev, prev2 = token, prev
+	}
+	return equals
+}
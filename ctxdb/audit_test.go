@@ -0,0 +1,182 @@
+package ctxdb_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/behaviorlog"
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type auditOrder struct {
+	ID     int64 `xorm:"'id' pk autoincr"`
+	Name   string
+	Status string
+}
+
+type auditEvents struct {
+	sync.Mutex
+	events []ctxdb.AuditEvent
+}
+
+func (s *auditEvents) Write(e *ctxdb.AuditEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, *e)
+	return nil
+}
+
+func (s *auditEvents) take() []ctxdb.AuditEvent {
+	s.Lock()
+	defer s.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestAudit(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	sink := &auditEvents{}
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.Audit(sink, new(auditOrder)))
+
+	c := &behaviorlog.LogContext{Username: "alice", TenantCode: "pangpang", RequestID: "request-1"}
+	session := db.NewSession(c.ToCtx(context.Background()))
+	defer session.Close()
+	ctx := ctxdb.ToCtx(context.Background(), session)
+
+	t.Run("committed", func(t *testing.T) {
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			s := ctxdb.FromCtx(ctx)
+			if _, err := s.Insert(&auditOrder{Name: "a", Status: "created"}); err != nil {
+				return err
+			}
+			if _, err := s.Exec("UPDATE audit_order SET status = ?, version = version + 1 WHERE id = ? AND status = ?", "paid", 1, "created"); err != nil {
+				return err
+			}
+			if _, err := s.Exec("UPDATE store SET name = ? WHERE id = ?", "a", 1); err != nil {
+				return err
+			}
+			test.Equals(t, 0, len(sink.take()))
+			return nil
+		})
+		test.Ok(t, err)
+
+		events := sink.take()
+		test.Equals(t, 2, len(events))
+
+		test.Equals(t, "audit_order", events[0].Table)
+		test.Equals(t, ctxdb.AuditInsert, events[0].Action)
+		test.Equals(t, map[string]interface{}{"id": int64(1)}, events[0].PrimaryKey)
+		test.Equals(t, []string{"name", "status"}, events[0].Columns)
+		test.Equals(t, map[string]interface{}{"name": "a", "status": "created"}, events[0].After)
+		test.Equals(t, "alice", events[0].Username)
+		test.Equals(t, "pangpang", events[0].TenantCode)
+		test.Equals(t, "request-1", events[0].RequestID)
+
+		test.Equals(t, ctxdb.AuditUpdate, events[1].Action)
+		test.Equals(t, map[string]interface{}{"id": 1}, events[1].PrimaryKey)
+		test.Equals(t, []string{"status"}, events[1].Columns)
+		test.Equals(t, map[string]interface{}{"status": "created"}, events[1].Before)
+		test.Equals(t, map[string]interface{}{"status": "paid"}, events[1].After)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			if _, err := ctxdb.FromCtx(ctx).Insert(&auditOrder{Name: "a"}); err != nil {
+				return err
+			}
+			return errors.New("failed")
+		})
+		test.Equals(t, "failed", err.Error())
+		test.Equals(t, 0, len(sink.take()))
+	})
+
+	t.Run("savepoint", func(t *testing.T) {
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			if _, err := ctxdb.FromCtx(ctx).Exec("DELETE FROM audit_order WHERE id IN (?,?)", 1, 2); err != nil {
+				return err
+			}
+			ctxdb.WithTx(ctx, func(ctx context.Context) error {
+				if _, err := ctxdb.FromCtx(ctx).Insert(&auditOrder{Name: "b"}); err != nil {
+					return err
+				}
+				return errors.New("failed")
+			}, ctxdb.Savepoint())
+			return nil
+		})
+		test.Ok(t, err)
+
+		events := sink.take()
+		test.Equals(t, 1, len(events))
+		test.Equals(t, ctxdb.AuditDelete, events[0].Action)
+		test.Equals(t, map[string]interface{}{"id": []interface{}{1, 2}}, events[0].PrimaryKey)
+	})
+
+	t.Run("auto-commit", func(t *testing.T) {
+		_, err := session.Exec("DELETE FROM `audit_order` WHERE `id` = ? AND status = ?", 3, "created")
+		test.Ok(t, err)
+
+		events := sink.take()
+		test.Equals(t, 1, len(events))
+		test.Equals(t, map[string]interface{}{"id": 3}, events[0].PrimaryKey)
+		test.Equals(t, map[string]interface{}{"id": 3, "status": "created"}, events[0].Before)
+	})
+
+	t.Run("before", func(t *testing.T) {
+		fake.setRows(func(query string) ([]string, [][]driver.Value) {
+			if !strings.HasPrefix(strings.Replace(query, "`", "", -1), "SELECT * FROM audit_order") {
+				return nil, nil
+			}
+			return []string{"id", "name", "status"}, [][]driver.Value{
+				{int64(1), "a", "created"},
+				{int64(2), "b", "paid"},
+			}
+		})
+		defer fake.setRows(nil)
+		fake.Reset()
+
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			_, err := ctxdb.FromCtx(ctx).Exec("UPDATE audit_order SET status = ? WHERE name IN (?,?)", "canceled", "a", "b")
+			return err
+		})
+		test.Ok(t, err)
+		// read in the transaction
+		test.Equals(t, "BEGIN; SELECT * FROM audit_order WHERE name IN (?,?) LIMIT 1001 FOR UPDATE; UPDATE audit_order SET status = ? WHERE name IN (?,?); COMMIT",
+			statements(fake.Log()))
+		test.Equals(t, []interface{}{"a", "b"}, fake.Args()[1])
+
+		events := sink.take()
+		test.Equals(t, 2, len(events))
+		test.Equals(t, map[string]interface{}{"id": int64(1)}, events[0].PrimaryKey)
+		test.Equals(t, map[string]interface{}{"status": "created"}, events[0].Before)
+		test.Equals(t, map[string]interface{}{"status": "canceled"}, events[0].After)
+		test.Equals(t, map[string]interface{}{"id": int64(2)}, events[1].PrimaryKey)
+		test.Equals(t, map[string]interface{}{"status": "paid"}, events[1].Before)
+
+		_, err = session.Exec("DELETE FROM audit_order WHERE status = ?", "created")
+		test.Ok(t, err)
+		events = sink.take()
+		test.Equals(t, 2, len(events))
+		test.Equals(t, ctxdb.AuditDelete, events[0].Action)
+		test.Equals(t, map[string]interface{}{"id": int64(1), "name": "a", "status": "created"}, events[0].Before)
+
+		// the rows are read by the session while the update of a bean is running
+		fake.Reset()
+		err = ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			_, err := ctxdb.FromCtx(ctx).Where("name IN (?,?)", "a", "b").Cols("status").Update(&auditOrder{Status: "canceled"})
+			return err
+		})
+		test.Ok(t, err)
+		test.Equals(t, "BEGIN; SELECT * FROM `audit_order` WHERE (name IN (?,?)) LIMIT 1001 FOR UPDATE; "+
+			"UPDATE `audit_order` SET `status` = ? WHERE (name IN (?,?)); COMMIT", statements(fake.Log()))
+		events = sink.take()
+		test.Equals(t, 2, len(events))
+		test.Equals(t, map[string]interface{}{"status": "paid"}, events[1].Before)
+	})
+}
@@ -0,0 +1,189 @@
+package ctxdb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pangpanglabs/goutils/cache"
+	"xorm.io/xorm/caches"
+	"xorm.io/xorm/contexts"
+)
+
+// QueryCache caches the results of Get and Find of the tables of beans in c, e.g. QueryCache(cache.NewRedis(uri), new(Country)).
+//
+// It's xorm's cacher: the primary keys of rows are cached by query, and the rows by primary key.
+// Only queries of a single table by beans (no Join, Select, Cols, SQL or ForUpdate) outside of transactions are cached.
+// A write to a table through a session invalidates its cached results, after the transaction is committed.
+// With cache.Redis, rows are encoded by its converter, so fields which are not encoded (e.g. `json:"-"`) are not cached.
+func QueryCache(c cache.Cache, beans ...interface{}) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.queryCache = c
+		db.cacheBeans = append(db.cacheBeans, beans...)
+	}
+}
+
+// cacher implements xorm's caches.Cacher by cache.Cache.
+// Cache.Cache can't delete keys by prefix, so the keys of a table have a version, which is changed to clear them.
+type cacher struct {
+	cache cache.Cache
+	// types maps tables to the struct types of their rows
+	types map[string]reflect.Type
+}
+
+var _ caches.Cacher = &cacher{}
+
+func newCacher(c cache.Cache) *cacher {
+	return &cacher{cache: c, types: map[string]reflect.Type{}}
+}
+
+// versionKey returns the key of the version of the keys of a table.
+// Tables are named like in parseSQLArgs, without the schema and quotes.
+func (c *cacher) versionKey(table, kind string) string {
+	return "ctxdb:" + unquoteIdentifier(table) + ":" + kind + ":version"
+}
+
+func (c *cacher) key(table, kind, k string) string {
+	var version string
+	if !c.cache.Load(c.versionKey(table, kind), &version) {
+		version = "0"
+	}
+	sum := sha1.Sum([]byte(k))
+	return "ctxdb:" + unquoteIdentifier(table) + ":" + kind + ":" + version + ":" + hex.EncodeToString(sum[:])
+}
+
+func (c *cacher) clear(table, kind string) {
+	c.cache.Store(c.versionKey(table, kind), strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+// GetIds returns the primary keys of sql, which are encoded by xorm as a string.
+func (c *cacher) GetIds(table, sql string) interface{} {
+	var s string
+	if !c.cache.Load(c.key(table, "ids", sql), &s) {
+		return nil
+	}
+	// the encoded primary keys are binary, which can't be encoded as JSON
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+func (c *cacher) PutIds(table, sql string, ids interface{}) {
+	if s, ok := ids.(string); ok {
+		c.cache.Store(c.key(table, "ids", sql), base64.StdEncoding.EncodeToString([]byte(s)))
+	}
+}
+
+func (c *cacher) DelIds(table, sql string) {
+	c.cache.Delete(c.key(table, "ids", sql))
+}
+
+func (c *cacher) ClearIds(table string) {
+	c.clear(table, "ids")
+}
+
+// GetBean returns a pointer to a new struct of the row.
+func (c *cacher) GetBean(table, id string) interface{} {
+	t, ok := c.types[unquoteIdentifier(table)]
+	if !ok {
+		return nil
+	}
+	bean := reflect.New(t)
+	if !c.cache.Load(c.key(table, "beans", id), bean.Interface()) {
+		return nil
+	}
+	return bean.Interface()
+}
+
+func (c *cacher) PutBean(table, id string, obj interface{}) {
+	if _, ok := c.types[unquoteIdentifier(table)]; ok {
+		c.cache.Store(c.key(table, "beans", id), reflect.Indirect(reflect.ValueOf(obj)).Interface())
+	}
+}
+
+func (c *cacher) DelBean(table, id string) {
+	c.cache.Delete(c.key(table, "beans", id))
+}
+
+func (c *cacher) ClearBeans(table string) {
+	c.clear(table, "beans")
+}
+
+type cacheKey struct{}
+
+// cacheSession keeps the tables written in the transaction of a session until it's committed.
+type cacheSession struct {
+	mu     sync.Mutex
+	inTx   bool
+	tables map[string]bool
+}
+
+// cacheHook clears the cache of tables written by SQL, including raw SQL which xorm doesn't clear.
+type cacheHook struct {
+	cacher *cacher
+}
+
+var _ contexts.Hook = &cacheHook{}
+
+func (h *cacheHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	return c.Ctx, nil
+}
+
+func (h *cacheHook) AfterProcess(c *contexts.ContextHook) error {
+	var s *cacheSession
+	if c.Ctx != nil {
+		s, _ = c.Ctx.Value(cacheKey{}).(*cacheSession)
+	}
+
+	sql := strings.ToUpper(strings.TrimSpace(c.SQL))
+	if s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch sql {
+		case "BEGIN TRANSACTION":
+			s.inTx, s.tables = c.Err == nil, nil
+			return nil
+		case "COMMIT":
+			for table := range s.tables {
+				h.clear(table)
+			}
+			s.inTx, s.tables = false, nil
+			return nil
+		case "ROLLBACK":
+			s.inTx, s.tables = false, nil
+			return nil
+		}
+	}
+
+	switch firstWord(sql) {
+	case "INSERT", "REPLACE", "UPDATE", "DELETE":
+	default:
+		return nil
+	}
+	table, _ := parseSQLArgs(c.SQL)
+	if _, ok := h.cacher.types[table]; !ok {
+		return nil
+	}
+	if s != nil && s.inTx {
+		if s.tables == nil {
+			s.tables = map[string]bool{}
+		}
+		s.tables[table] = true
+		return nil
+	}
+	h.clear(table)
+	return nil
+}
+
+func (h *cacheHook) clear(table string) {
+	h.cacher.ClearIds(table)
+	h.cacher.ClearBeans(table)
+}
@@ -0,0 +1,114 @@
+package ctxdb_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/cache"
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type country struct {
+	ID   int64 `xorm:"'id' pk"`
+	Name string
+}
+
+// jsonCache encodes values as JSON like cache.Redis.
+type jsonCache struct {
+	m sync.Map
+}
+
+func (c *jsonCache) LoadOrStore(key string, value interface{}, getter func() (interface{}, error)) (bool, error) {
+	if c.Load(key, value) {
+		return true, nil
+	}
+	v, err := getter()
+	if err != nil {
+		return false, err
+	}
+	c.Store(key, v)
+	return false, nil
+}
+func (c *jsonCache) Delete(key string) error { c.m.Delete(key); return nil }
+func (c *jsonCache) Load(key string, value interface{}) bool {
+	b, ok := c.m.Load(key)
+	return ok && json.Unmarshal(b.([]byte), value) == nil
+}
+func (c *jsonCache) Store(key string, value interface{}) {
+	b, _ := json.Marshal(value)
+	c.m.Store(key, b)
+}
+
+func TestQueryCache(t *testing.T) {
+	for name, c := range map[string]cache.Cache{"local": &cache.Local{}, "json": &jsonCache{}} {
+		t.Run(name, func(t *testing.T) {
+			testQueryCache(t, c)
+		})
+	}
+}
+
+func testQueryCache(t *testing.T, c cache.Cache) {
+	engine, fake := newFakeEngine(t)
+	fake.setRows(func(query string) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT `id` FROM `country`") {
+			return []string{"id"}, [][]driver.Value{{int64(1)}}
+		}
+		return []string{"id", "name"}, [][]driver.Value{{int64(1), "Korea"}}
+	})
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.QueryCache(c, new(country)))
+
+	session := db.NewSession(context.Background())
+	defer session.Close()
+	ctx := ctxdb.ToCtx(context.Background(), session)
+
+	get := func() int {
+		fake.Reset()
+		var c country
+		has, err := db.NewSession(context.Background()).ID(1).Get(&c)
+		test.Ok(t, err)
+		test.Assert(t, has, "country should exist")
+		test.Equals(t, country{1, "Korea"}, c)
+		return len(fake.Log())
+	}
+	find := func() int {
+		fake.Reset()
+		var countries []country
+		test.Ok(t, db.NewSession(context.Background()).Where("name = ?", "Korea").Find(&countries))
+		test.Equals(t, []country{{1, "Korea"}}, countries)
+		return len(fake.Log())
+	}
+
+	test.Assert(t, get() != 0, "first get should query the database")
+	test.Equals(t, 0, get())
+	test.Assert(t, find() != 0, "first find should query the database")
+	test.Equals(t, 0, find())
+
+	err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := ctxdb.FromCtx(ctx).Exec("UPDATE country SET name = ? WHERE id = ?", "Korea", 1); err != nil {
+			return err
+		}
+		// invalidated after commit
+		test.Equals(t, 0, get())
+		return nil
+	})
+	test.Ok(t, err)
+	test.Assert(t, get() != 0, "get should query the database after commit")
+	test.Assert(t, find() != 0, "find should query the database after commit")
+
+	// other tables don't invalidate the cache
+	_, err = session.Exec("UPDATE store SET name = ? WHERE id = ?", "a", 1)
+	test.Ok(t, err)
+	test.Equals(t, 0, get())
+	test.Equals(t, 0, find())
+
+	// writes out of transactions invalidate the cache at once
+	_, err = session.Exec("DELETE FROM country WHERE id = ?", 1)
+	test.Ok(t, err)
+	test.Assert(t, get() != 0, "get should query the database after delete")
+}
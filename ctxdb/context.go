@@ -0,0 +1,45 @@
+package ctxdb
+
+import (
+	"context"
+
+	"xorm.io/xorm"
+)
+
+// DefaultName is the name of the session put by ToCtx.
+const DefaultName = "DB"
+
+// ContextDBType is the type of the old context keys of sessions, which are still set by ToCtx and looked up by FromCtx.
+//
+// Deprecated: use FromCtx and ToCtx.
+type ContextDBType string
+
+type contextKey struct {
+	name string
+}
+
+func ToCtx(ctx context.Context, session *xorm.Session) context.Context {
+	return ToCtxWithName(ctx, DefaultName, session)
+}
+
+// ToCtxWithName puts a session with a name, e.g. when a service uses more than one database.
+func ToCtxWithName(ctx context.Context, name string, session *xorm.Session) context.Context {
+	// the old key is still set for code that reads it directly
+	return context.WithValue(context.WithValue(ctx, ContextDBType(name), session), contextKey{name}, session)
+}
+
+// FromCtx returns the session put by ToCtx, or nil.
+func FromCtx(ctx context.Context) *xorm.Session {
+	return FromCtxWithName(ctx, DefaultName)
+}
+
+func FromCtxWithName(ctx context.Context, name string) *xorm.Session {
+	if ctx == nil {
+		return nil
+	}
+	if session, ok := ctx.Value(contextKey{name}).(*xorm.Session); ok {
+		return session
+	}
+	session, _ := ctx.Value(ContextDBType(name)).(*xorm.Session)
+	return session
+}
@@ -0,0 +1,26 @@
+package ctxdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/test"
+	"xorm.io/xorm"
+)
+
+func TestFromCtx(t *testing.T) {
+	engine, _ := newFakeEngine(t)
+	session := engine.NewSession()
+	defer session.Close()
+
+	ctx := ctxdb.ToCtxWithName(context.Background(), "other", session)
+	test.Equals(t, session, ctxdb.FromCtxWithName(ctx, "other"))
+	test.Assert(t, ctxdb.FromCtx(ctx) == nil, "expected no default session")
+
+	// the old key is still set and supported
+	old, _ := ctxdb.ToCtx(context.Background(), session).Value(ctxdb.ContextDBType(ctxdb.DefaultName)).(*xorm.Session)
+	test.Equals(t, session, old)
+	ctx = context.WithValue(context.Background(), ctxdb.ContextDBType(ctxdb.DefaultName), session)
+	test.Equals(t, session, ctxdb.FromCtx(ctx))
+}
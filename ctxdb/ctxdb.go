@@ -2,37 +2,185 @@ package ctxdb
 
 import (
 	"context"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/pangpanglabs/goutils/cache"
 	"github.com/pangpanglabs/goutils/kafka"
 	"xorm.io/xorm"
+	xormlog "xorm.io/xorm/log"
 )
 
+// ContextDB is the primary database, with optional read replicas.
 type ContextDB struct {
 	*xorm.Engine
+
+	replicas            []*replica
+	policy              ReplicaPolicy
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	stop                chan struct{}
+
+	slowQueryThreshold time.Duration
+	sinks              []SqlLogSink
+	redactor           *Redactor
+	producer           *kafka.Producer
+	metrics            *Metrics
+
+	tenantColumn string
+	tenantTables []string
+
+	auditSink  AuditSink
+	auditBeans []interface{}
+
+	queryCache cache.Cache
+	cacheBeans []interface{}
+
+	txRetry []func(*TxOptions)
 }
 
-func New(db *xorm.Engine, service string, config kafka.Config) *ContextDB {
+func New(db *xorm.Engine, service string, config kafka.Config, options ...func(*ContextDB)) *ContextDB {
+	c := &ContextDB{
+		Engine:              db,
+		policy:              RoundRobin(),
+		healthCheckInterval: DefaultHealthCheckInterval,
+		healthCheckTimeout:  DefaultHealthCheckTimeout,
+	}
+	for _, option := range options {
+		if option != nil {
+			option(c)
+		}
+	}
+
 	// db.ShowExecTime()
 	if len(config.Brokers) != 0 {
 		if producer, err := kafka.NewProducer(config.Brokers, config.Topic,
 			kafka.WithDefault(),
 			kafka.WithTLS(config.SSL)); err == nil {
-			db.SetLogger(&dbLogger{serviceName: service, Producer: producer})
-			db.ShowSQL()
+			c.producer = producer
+			c.sinks = append(c.sinks, KafkaSink(producer))
+		} else {
+			log.Println("ctxdb: failed to create kafka producer for sql log:", err)
+		}
+	}
+	if len(c.sinks) != 0 || c.metrics != nil {
+		logger := &dbLogger{
+			serviceName:        service,
+			slowQueryThreshold: c.slowQueryThreshold,
+			level:              xormlog.LOG_WARNING,
+			redactor:           c.redactor,
+			metrics:            c.metrics,
+		}
+		if len(c.sinks) != 0 {
+			logger.sink = FanOut(c.sinks...)
+		}
+		for _, engine := range c.engines() {
+			engine.SetLogger(logger)
+			engine.ShowSQL()
+		}
+	}
+
+	if len(c.tenantTables) != 0 {
+		scope := newTenantScope(c.tenantColumn, c.tenantTables)
+		for _, engine := range c.engines() {
+			hook := &tenantHook{tenantScope: scope, scoped: true}
+			if err := scopeTenant(engine, scope); err != nil {
+				log.Println("ctxdb: failed to scope tenant-scoped tables:", err)
+				hook.scoped = false
+			}
+			engine.AddHook(hook)
+		}
+	}
+
+	if c.auditSink != nil {
+		hook := &auditHook{service: service, tables: map[string][]string{}, sink: c.auditSink}
+		for _, bean := range c.auditBeans {
+			table, err := db.TableInfo(bean)
+			if err != nil {
+				log.Println("ctxdb: failed to audit table:", err)
+				continue
+			}
+			var primaryKey []string
+			for _, column := range table.PrimaryKeys {
+				primaryKey = append(primaryKey, strings.ToLower(column))
+			}
+			hook.tables[strings.ToLower(table.Name)] = primaryKey
 		}
+		// replicas are read-only
+		db.AddHook(hook)
 	}
 
-	return &ContextDB{Engine: db}
+	if c.queryCache != nil {
+		cacher := newCacher(c.queryCache)
+		for _, bean := range c.cacheBeans {
+			cacher.types[unquoteIdentifier(db.TableName(bean, true))] = reflect.Indirect(reflect.ValueOf(bean)).Type()
+			for _, engine := range c.engines() {
+				engine.MapCacher(bean, cacher)
+			}
+		}
+		db.AddHook(&cacheHook{cacher: cacher})
+	}
+
+	if len(c.replicas) != 0 {
+		for _, r := range c.replicas {
+			replicaEngines.Store(r.Engine, c)
+		}
+		c.startHealthCheck()
+	}
+
+	return c
 }
 
+// NewSession returns a session of a healthy replica if ctx is read-only (see WithReadOnly), otherwise of the primary.
 func (db *ContextDB) NewSession(ctx context.Context) *xorm.Session {
-	session := db.Engine.NewSession()
+	engine := db.Engine
+	if readOnly, _ := ReadOnlyFromCtx(ctx); readOnly {
+		if r := db.replica(); r != nil {
+			engine = r
+		}
+	}
+	session := engine.NewSession()
+	if ctx != nil {
+		if db.auditSink != nil {
+			ctx = context.WithValue(ctx, auditKey{}, &auditSession{session: session})
+		}
+		if db.queryCache != nil {
+			ctx = context.WithValue(ctx, cacheKey{}, &cacheSession{})
+		}
+		session.Context(ctx)
+	}
+	return session
+}
 
-	func(session interface{}, ctx context.Context) {
-		if s, ok := session.(interface{ SetContext(context.Context) }); ok {
-			s.SetContext(ctx)
+// Close stops the health check, closes the sinks of SQL logs, and closes the replicas and the primary.
+func (db *ContextDB) Close() error {
+	if db.stop != nil {
+		close(db.stop)
+	}
+	for _, sink := range db.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			closer.Close()
 		}
-	}(session, ctx)
+	}
+	if db.producer != nil {
+		db.producer.Close()
+	}
+	for _, r := range db.replicas {
+		replicaEngines.Delete(r.Engine)
+		tenantConnectors.Delete(r.Engine)
+		r.Close()
+	}
+	tenantConnectors.Delete(db.Engine)
+	return db.Engine.Close()
+}
 
-	return session
+func (db *ContextDB) engines() []*xorm.Engine {
+	engines := []*xorm.Engine{db.Engine}
+	for _, r := range db.replicas {
+		engines = append(engines, r.Engine)
+	}
+	return engines
 }
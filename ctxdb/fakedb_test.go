@@ -0,0 +1,196 @@
+package ctxdb_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/schemas"
+)
+
+// fakeDB is a database/sql driver which records statements, so that ctxdb can be tested without a database.
+type fakeDB struct {
+	mu   sync.Mutex
+	log  []string
+	args [][]interface{}
+	// fail returns an error for a statement, if it's set
+	fail func(query string) error
+	// rows returns the result of a query, if it's set
+	rows func(query string) (columns []string, values [][]driver.Value)
+}
+
+var fakeDBs = struct {
+	sync.Mutex
+	m map[string]*fakeDB
+}{m: map[string]*fakeDB{}}
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+	dialects.RegisterDriver("fakedb", fakeDriver{})
+}
+
+// newFakeEngine returns an engine on a new fakeDB named after the test and suffix.
+func newFakeEngine(t *testing.T, suffix ...string) (*xorm.Engine, *fakeDB) {
+	name := t.Name() + strings.Join(suffix, "")
+	db := &fakeDB{}
+	fakeDBs.Lock()
+	fakeDBs.m[name] = db
+	fakeDBs.Unlock()
+
+	engine, err := xorm.NewEngine("fakedb", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine, db
+}
+
+func (db *fakeDB) setFail(fail func(query string) error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.fail = fail
+}
+
+func (db *fakeDB) setRows(rows func(query string) ([]string, [][]driver.Value)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rows = rows
+}
+
+func (db *fakeDB) record(query string, args ...driver.NamedValue) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.fail != nil {
+		if err := db.fail(query); err != nil {
+			return err
+		}
+	}
+	db.log = append(db.log, query)
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	db.args = append(db.args, values)
+	return nil
+}
+
+func (db *fakeDB) Log() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.log...)
+}
+
+// Args returns the args of the recorded statements.
+func (db *fakeDB) Args() [][]interface{} {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([][]interface{}(nil), db.args...)
+}
+
+func (db *fakeDB) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.log = nil
+	db.args = nil
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBs.Lock()
+	defer fakeDBs.Unlock()
+	return &fakeConn{db: fakeDBs.m[name]}, nil
+}
+
+func (fakeDriver) Parse(driverName, dataSourceName string) (*dialects.URI, error) {
+	return &dialects.URI{DBType: schemas.MYSQL, DBName: "test"}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	if err := c.db.record("BEGIN"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+func (c *fakeConn) Ping(ctx context.Context) error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.fail != nil {
+		return c.db.fail("PING")
+	}
+	return nil
+}
+func (c *fakeConn) Commit() error   { return c.db.record("COMMIT") }
+func (c *fakeConn) Rollback() error { return c.db.record("ROLLBACK") }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.record(query, args...); err != nil {
+		return nil, err
+	}
+	return fakeResult{}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.record(query, args...); err != nil {
+		return nil, err
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.rows != nil {
+		columns, values := c.db.rows(query)
+		return &fakeRows{columns: columns, values: values}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+// fakeResult is the result of a statement affecting a row.
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, nil)
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, nil)
+}
+
+// fakeRows is a result set, which is empty by default.
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func statements(log []string) string {
+	return strings.Join(log, "; ")
+}
@@ -0,0 +1,36 @@
+package ctxdb
+
+import "github.com/pangpanglabs/goutils/ctxbase"
+
+// StringID is a primary key generated by the ctxbase ID generator (see ctxbase.UseIDGenerator).
+// Embed it into a model with `xorm:"extends"`:
+//
+//	type Order struct {
+//		ctxdb.StringID `xorm:"extends"`
+//		Amount         float64
+//	}
+//
+// The ID is generated on insert if it's empty. A model which has its own BeforeInsert must call StringID.BeforeInsert.
+type StringID struct {
+	ID string `json:"id" xorm:"'id' pk varchar(36)"`
+}
+
+// BeforeInsert is called by xorm. If the current generator fails, a UUIDv4 is used (see ctxbase.NewID).
+func (m *StringID) BeforeInsert() {
+	if m.ID == "" {
+		m.ID = ctxbase.NewID()
+	}
+}
+
+// Int64ID is like StringID, and generated by ctxbase.DefaultSnowflake.
+type Int64ID struct {
+	ID int64 `json:"id" xorm:"'id' pk"`
+}
+
+// BeforeInsert is called by xorm. If the clock moved backwards, the ID is generated from the last timestamp
+// (see ctxbase.Snowflake.ForceNextID).
+func (m *Int64ID) BeforeInsert() {
+	if m.ID == 0 {
+		m.ID = ctxbase.DefaultSnowflake().ForceNextID()
+	}
+}
@@ -2,71 +2,135 @@ package ctxdb
 
 import (
 	"context"
+	"fmt"
+	stdlog "log"
 	"time"
 
 	"github.com/pangpanglabs/goutils/behaviorlog"
 	"github.com/pangpanglabs/goutils/ctxbase"
-	"github.com/pangpanglabs/goutils/kafka"
-	"xorm.io/core"
+	xormlog "xorm.io/xorm/log"
 )
 
 type SqlLog struct {
-	Service   string      `json:"service,omitempty"`
-	RequestID string      `json:"requestId,omitempty"`
-	ActionID  string      `json:"actionId,omitempty"`
-	Sql       interface{} `json:"sql,omitempty"`
-	Args      interface{} `json:"args,omitempty"`
-	Took      interface{} `json:"took,omitempty"`
-	Timestamp time.Time   `json:"timestamp,omitempty"`
+	Service      string      `json:"service,omitempty"`
+	RequestID    string      `json:"requestId,omitempty"`
+	ActionID     string      `json:"actionId,omitempty"`
+	Sql          interface{} `json:"sql,omitempty"`
+	Args         interface{} `json:"args,omitempty"`
+	Took         interface{} `json:"took,omitempty"`
+	RowsAffected int64       `json:"rowsAffected,omitempty"`
+	Slow         bool        `json:"slow,omitempty"`
+	Retry        int         `json:"retry,omitempty"`
+	Level        string      `json:"level,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	Message      string      `json:"message,omitempty"`
+	Timestamp    time.Time   `json:"timestamp,omitempty"`
 }
+
+// SlowQueryThreshold flags SQL taking longer than d as slow in the SQL log. Zero disables it.
+func SlowQueryThreshold(d time.Duration) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.slowQueryThreshold = d
+	}
+}
+
+// dbLogger implements xorm's log.ContextLogger. Every SQL is logged by AfterSQL,
+// and the other messages of xorm are logged according to the level.
 type dbLogger struct {
-	serviceName string
-	*kafka.Producer
+	serviceName        string
+	slowQueryThreshold time.Duration
+	level              xormlog.LogLevel
+	sink               SqlLogSink
+	redactor           *Redactor
+	// metrics is nil if SQL metrics are not collected, and sink is nil if SQL is only counted in metrics
+	metrics *Metrics
 }
 
-func (logger *dbLogger) Write(v []interface{}) {
-	if len(v) == 0 {
+var _ xormlog.ContextLogger = &dbLogger{}
+
+func (logger *dbLogger) BeforeSQL(ctx xormlog.LogContext) {}
+
+func (logger *dbLogger) AfterSQL(ctx xormlog.LogContext) {
+	if logger.metrics != nil {
+		logger.metrics.Observe(logger.serviceName, ctx.SQL, ctx.ExecuteTime, ctx.Err)
+	}
+	if logger.sink == nil {
 		return
 	}
 	log := SqlLog{
 		Service:   logger.serviceName,
-		Sql:       v[0],
-		Timestamp: time.Now(),
+		Sql:       ctx.SQL,
+		Took:      ctx.ExecuteTime,
+		Timestamp: time.Now().Add(-ctx.ExecuteTime),
+	}
+	if len(ctx.Args) != 0 {
+		log.Args = logger.redactor.Redact(ctx.SQL, ctx.Args)
+	}
+	log.RequestID, log.ActionID = ids(ctx.Ctx)
+	if ctx.Result != nil {
+		log.RowsAffected, _ = ctx.Result.RowsAffected()
+	}
+	if logger.slowQueryThreshold > 0 && ctx.ExecuteTime >= logger.slowQueryThreshold {
+		log.Slow = true
+		log.Level = "warn"
+	}
+	if ctx.Err != nil {
+		log.Error = logger.redactor.RedactError(ctx.SQL, ctx.Err.Error())
+		log.Level = "error"
+	}
+
+	logger.write(&log)
+}
+
+func (logger *dbLogger) write(log *SqlLog) {
+	if logger.sink == nil {
+		return
 	}
-	if ctx, ok := v[len(v)-1].(context.Context); ok {
-		if cb := ctxbase.FromCtx(ctx); cb != nil {
-			log.ActionID = cb.ActionID
-			log.RequestID = cb.RequestID
-		} else if cl := behaviorlog.FromCtx(ctx); cl != nil {
-			log.ActionID = cl.ActionID
-			log.RequestID = cl.RequestID
-		}
-		v = v[:len(v)-1]
+	if err := logger.sink.Write(log); err != nil {
+		stdlog.Println("ctxdb: failed to write sql log:", err)
 	}
+}
 
-	if len(v) == 3 {
-		log.Args = v[1]
-		log.Took = v[2]
-	} else if len(v) == 2 {
-		log.Took = v[1]
+// ids returns the request ID and action ID of ctx.
+func ids(ctx context.Context) (requestID, actionID string) {
+	if ctx == nil {
+		return "", ""
 	}
+	if cb := ctxbase.FromCtx(ctx); cb != nil {
+		return cb.RequestID, cb.ActionID
+	}
+	if cl := behaviorlog.FromCtx(ctx); cl != nil {
+		return cl.RequestID, cl.ActionID
+	}
+	return "", ""
+}
 
-	if d, ok := log.Took.(time.Duration); ok {
-		log.Timestamp = log.Timestamp.Add(-d)
+func (logger *dbLogger) logf(level xormlog.LogLevel, name, format string, v ...interface{}) {
+	if level < logger.level {
+		return
 	}
+	logger.write(&SqlLog{
+		Service:   logger.serviceName,
+		Level:     name,
+		Message:   fmt.Sprintf(format, v...),
+		Timestamp: time.Now(),
+	})
+}
 
-	logger.Send(&log)
+func (logger *dbLogger) Debugf(format string, v ...interface{}) {
+	logger.logf(xormlog.LOG_DEBUG, "debug", format, v...)
+}
+func (logger *dbLogger) Infof(format string, v ...interface{}) {
+	logger.logf(xormlog.LOG_INFO, "info", format, v...)
+}
+func (logger *dbLogger) Warnf(format string, v ...interface{}) {
+	logger.logf(xormlog.LOG_WARNING, "warn", format, v...)
+}
+func (logger *dbLogger) Errorf(format string, v ...interface{}) {
+	logger.logf(xormlog.LOG_ERR, "error", format, v...)
 }
-func (logger *dbLogger) Infof(format string, v ...interface{})  { logger.Write(v) }
-func (logger *dbLogger) Errorf(format string, v ...interface{}) {}
-func (logger *dbLogger) Debugf(format string, v ...interface{}) {}
-func (logger *dbLogger) Warnf(format string, v ...interface{})  {}
 
-func (logger *dbLogger) Debug(v ...interface{})   {}
-func (logger *dbLogger) Error(v ...interface{})   {}
-func (logger *dbLogger) Info(v ...interface{})    {}
-func (logger *dbLogger) Warn(v ...interface{})    {}
-func (logger *dbLogger) SetLevel(l core.LogLevel) {}
-func (logger *dbLogger) ShowSQL(show ...bool)     {}
-func (logger *dbLogger) Level() core.LogLevel     { return 0 }
-func (logger *dbLogger) IsShowSQL() bool          { return true }
+func (logger *dbLogger) Level() xormlog.LogLevel     { return logger.level }
+func (logger *dbLogger) SetLevel(l xormlog.LogLevel) { logger.level = l }
+func (logger *dbLogger) ShowSQL(show ...bool)        {}
+func (logger *dbLogger) IsShowSQL() bool             { return true }
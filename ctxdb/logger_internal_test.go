@@ -0,0 +1,71 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/test"
+	"xorm.io/xorm/contexts"
+	xormlog "xorm.io/xorm/log"
+)
+
+func TestDBLogger(t *testing.T) {
+	sink := NewMemorySink()
+	logger := &dbLogger{
+		serviceName:        "test",
+		slowQueryThreshold: time.Second,
+		level:              xormlog.LOG_WARNING,
+		sink:               sink,
+	}
+	cb := ctxbase.New("req-1", "", "")
+	ctx := cb.ToCtx(context.Background())
+
+	logger.AfterSQL(xormlog.LogContext(contexts.ContextHook{
+		Ctx:         ctx,
+		SQL:         "UPDATE t SET a = ?",
+		Args:        []interface{}{1},
+		Result:      driver.RowsAffected(3),
+		ExecuteTime: 10 * time.Millisecond,
+	}))
+	logger.AfterSQL(xormlog.LogContext(contexts.ContextHook{
+		Ctx:         ctx,
+		SQL:         "SELECT * FROM t WHERE a = ?",
+		Args:        []interface{}{1},
+		ExecuteTime: 2 * time.Second,
+	}))
+	logger.AfterSQL(xormlog.LogContext(contexts.ContextHook{
+		Ctx:         ctx,
+		SQL:         "INSERT INTO t VALUES (?)",
+		Args:        []interface{}{1},
+		ExecuteTime: time.Millisecond,
+		Err:         errors.New("Error 1062: Duplicate entry '1' for key 'PRIMARY'"),
+	}))
+	logger.Infof("PING DATABASE %v", "mysql")
+	logger.Warnf("table %s has no primary key", "t")
+
+	logs := sink.Logs()
+	test.Equals(t, 4, len(logs))
+
+	test.Equals(t, "test", logs[0].Service)
+	test.Equals(t, "req-1", logs[0].RequestID)
+	test.Equals(t, cb.ActionID, logs[0].ActionID)
+	test.Equals(t, "UPDATE t SET a = ?", logs[0].Sql)
+	test.Equals(t, []interface{}{1}, logs[0].Args)
+	test.Equals(t, int64(3), logs[0].RowsAffected)
+	test.Equals(t, false, logs[0].Slow)
+	test.Equals(t, "", logs[0].Level)
+
+	test.Equals(t, true, logs[1].Slow)
+	test.Equals(t, "warn", logs[1].Level)
+
+	test.Equals(t, "INSERT INTO t VALUES (?)", logs[2].Sql)
+	test.Equals(t, "Error 1062: Duplicate entry '1' for key 'PRIMARY'", logs[2].Error)
+	test.Equals(t, "error", logs[2].Level)
+
+	test.Equals(t, "warn", logs[3].Level)
+	test.Equals(t, "table t has no primary key", logs[3].Message)
+}
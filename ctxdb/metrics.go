@@ -0,0 +1,172 @@
+package ctxdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds (in seconds) of the buckets of the latency histogram.
+var DefaultLatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics counts SQL and their errors, and the histogram of their latency, by service, operation and table.
+// Operations are select, insert, update, delete and other (e.g. BEGIN, COMMIT and DDL).
+// It's an http.Handler which writes the metrics in the Prometheus text format.
+type Metrics struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[metricLabels]*metricSeries
+}
+
+type metricLabels struct {
+	service, operation, table string
+}
+
+type metricSeries struct {
+	count, errors uint64
+	sum           float64
+	// buckets are the counts of each bucket, which are not cumulative
+	buckets []uint64
+}
+
+// NewMetrics returns metrics with the latency buckets, which are DefaultLatencyBuckets if buckets are empty.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{buckets: buckets, series: map[metricLabels]*metricSeries{}}
+}
+
+// WithMetrics collects the metrics of SQL, which can be shared by several ContextDBs.
+func WithMetrics(m *Metrics) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.metrics = m
+	}
+}
+
+// Observe counts sql of service, which took took and failed if err isn't nil.
+func (m *Metrics) Observe(service, sql string, took time.Duration, err error) {
+	labels := metricLabels{service: service, operation: sqlOperation(sql)}
+	if labels.operation != "other" {
+		labels.table, _ = parseSQLArgs(sql)
+	}
+	seconds := took.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[labels]
+	if !ok {
+		s = &metricSeries{buckets: make([]uint64, len(m.buckets))}
+		m.series[labels] = s
+	}
+	s.count++
+	s.sum += seconds
+	if err != nil {
+		s.errors++
+	}
+	if i := sort.SearchFloat64s(m.buckets, seconds); i < len(m.buckets) {
+		s.buckets[i]++
+	}
+}
+
+func sqlOperation(sql string) string {
+	switch op := strings.ToLower(firstWord(sql)); op {
+	case "select", "insert", "update", "delete":
+		return op
+	case "replace":
+		return "insert"
+	default:
+		return "other"
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	labels := make([]metricLabels, 0, len(m.series))
+	series := make(map[metricLabels]metricSeries, len(m.series))
+	for l, s := range m.series {
+		labels = append(labels, l)
+		series[l] = metricSeries{s.count, s.errors, s.sum, append([]uint64(nil), s.buckets...)}
+	}
+	m.mu.Unlock()
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.table != b.table {
+			return a.table < b.table
+		}
+		return a.operation < b.operation
+	})
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	fmt.Fprintln(cw, "# HELP ctxdb_queries_total Number of SQL statements.")
+	fmt.Fprintln(cw, "# TYPE ctxdb_queries_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(cw, "ctxdb_queries_total{%s} %d\n", l, series[l].count)
+	}
+	fmt.Fprintln(cw, "# HELP ctxdb_query_errors_total Number of failed SQL statements.")
+	fmt.Fprintln(cw, "# TYPE ctxdb_query_errors_total counter")
+	for _, l := range labels {
+		fmt.Fprintf(cw, "ctxdb_query_errors_total{%s} %d\n", l, series[l].errors)
+	}
+	fmt.Fprintln(cw, "# HELP ctxdb_query_duration_seconds Latency of SQL statements.")
+	fmt.Fprintln(cw, "# TYPE ctxdb_query_duration_seconds histogram")
+	for _, l := range labels {
+		s := series[l]
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(cw, "ctxdb_query_duration_seconds_bucket{%s,le=\"%s\"} %d\n", l, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(cw, "ctxdb_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, s.count)
+		fmt.Fprintf(cw, "ctxdb_query_duration_seconds_sum{%s} %s\n", l, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(cw, "ctxdb_query_duration_seconds_count{%s} %d\n", l, s.count)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func (l metricLabels) String() string {
+	return fmt.Sprintf(`service="%s",operation="%s",table="%s"`, escapeLabel(l.service), l.operation, escapeLabel(l.table))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
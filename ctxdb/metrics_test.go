@@ -0,0 +1,81 @@
+package ctxdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestMetrics(t *testing.T) {
+	m := ctxdb.NewMetrics(0.01, 0.1)
+	m.Observe("test", "SELECT * FROM `order` WHERE id = ?", 5*time.Millisecond, nil)
+	m.Observe("test", "SELECT * FROM `order` WHERE id = ?", 50*time.Millisecond, nil)
+	m.Observe("test", "UPDATE `order` SET status = ? WHERE id = ?", time.Second, errors.New("deadlock"))
+	m.Observe("test", "COMMIT", time.Millisecond, nil)
+
+	var b bytes.Buffer
+	_, err := m.WriteTo(&b)
+	test.Ok(t, err)
+	test.Equals(t, `# HELP ctxdb_queries_total Number of SQL statements.
+# TYPE ctxdb_queries_total counter
+ctxdb_queries_total{service="test",operation="other",table=""} 1
+ctxdb_queries_total{service="test",operation="select",table="order"} 2
+ctxdb_queries_total{service="test",operation="update",table="order"} 1
+# HELP ctxdb_query_errors_total Number of failed SQL statements.
+# TYPE ctxdb_query_errors_total counter
+ctxdb_query_errors_total{service="test",operation="other",table=""} 0
+ctxdb_query_errors_total{service="test",operation="select",table="order"} 0
+ctxdb_query_errors_total{service="test",operation="update",table="order"} 1
+# HELP ctxdb_query_duration_seconds Latency of SQL statements.
+# TYPE ctxdb_query_duration_seconds histogram
+ctxdb_query_duration_seconds_bucket{service="test",operation="other",table="",le="0.01"} 1
+ctxdb_query_duration_seconds_bucket{service="test",operation="other",table="",le="0.1"} 1
+ctxdb_query_duration_seconds_bucket{service="test",operation="other",table="",le="+Inf"} 1
+ctxdb_query_duration_seconds_sum{service="test",operation="other",table=""} 0.001
+ctxdb_query_duration_seconds_count{service="test",operation="other",table=""} 1
+ctxdb_query_duration_seconds_bucket{service="test",operation="select",table="order",le="0.01"} 1
+ctxdb_query_duration_seconds_bucket{service="test",operation="select",table="order",le="0.1"} 2
+ctxdb_query_duration_seconds_bucket{service="test",operation="select",table="order",le="+Inf"} 2
+ctxdb_query_duration_seconds_sum{service="test",operation="select",table="order"} 0.055
+ctxdb_query_duration_seconds_count{service="test",operation="select",table="order"} 2
+ctxdb_query_duration_seconds_bucket{service="test",operation="update",table="order",le="0.01"} 0
+ctxdb_query_duration_seconds_bucket{service="test",operation="update",table="order",le="0.1"} 0
+ctxdb_query_duration_seconds_bucket{service="test",operation="update",table="order",le="+Inf"} 1
+ctxdb_query_duration_seconds_sum{service="test",operation="update",table="order"} 1
+ctxdb_query_duration_seconds_count{service="test",operation="update",table="order"} 1
+`, b.String())
+}
+
+func TestMetricsWithoutSink(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	fake.setFail(func(query string) error {
+		if strings.HasPrefix(query, "DELETE") {
+			return errors.New("lock wait timeout")
+		}
+		return nil
+	})
+	m := ctxdb.NewMetrics()
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.WithMetrics(m))
+
+	session := db.NewSession(context.Background())
+	defer session.Close()
+	_, err := session.Exec("INSERT INTO member (name) VALUES (?)", "foo")
+	test.Ok(t, err)
+	_, err = session.Exec("DELETE FROM member WHERE id = ?", 1)
+	test.Assert(t, err != nil, "delete should fail")
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	test.Equals(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	test.Assert(t, strings.Contains(body, `ctxdb_queries_total{service="test",operation="insert",table="member"} 1`+"\n"), "insert should be counted: %s", body)
+	test.Assert(t, strings.Contains(body, `ctxdb_query_errors_total{service="test",operation="delete",table="member"} 1`+"\n"), "delete error should be counted: %s", body)
+}
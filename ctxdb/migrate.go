@@ -0,0 +1,491 @@
+package ctxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	DefaultMigrationTable       = "schema_migrations"
+	DefaultMigrationLockTimeout = time.Minute
+)
+
+var (
+	ErrIrreversible     = errors.New("ctxdb: migration has no down")
+	ErrMigrationLocked  = errors.New("ctxdb: failed to lock migrations")
+	ErrUnknownMigration = errors.New("ctxdb: unknown migration version")
+)
+
+// Migration changes the schema from the previous version to Version by Up, and back by Down.
+// Up and Down run in a transaction, but MySQL commits DDL statements implicitly.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(session *xorm.Session) error
+	Down    func(session *xorm.Session) error
+}
+
+// SQLMigration returns a migration running SQL statements separated by ";".
+func SQLMigration(version int64, name, up, down string) Migration {
+	m := Migration{Version: version, Name: name, Up: execSQL(up)}
+	if strings.TrimSpace(down) != "" {
+		m.Down = execSQL(down)
+	}
+	return m
+}
+
+func execSQL(sql string) func(session *xorm.Session) error {
+	return func(session *xorm.Session) error {
+		for _, statement := range splitStatements(sql) {
+			if _, err := session.Exec(statement); err != nil {
+				return fmt.Errorf("%w: %s", err, statement)
+			}
+		}
+		return nil
+	}
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads migrations from the SQL files in dir, named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// e.g. 20200601120000_create_order.up.sql. Other files are ignored.
+func LoadMigrations(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type sqls struct{ name, up, down string }
+	m := map[int64]*sqls{}
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s, ok := m[version]
+		if !ok {
+			s = &sqls{name: match[2]}
+			m[version] = s
+		} else if s.name != match[2] {
+			return nil, fmt.Errorf("ctxdb: migration %d has different names: %s, %s", version, s.name, match[2])
+		}
+		if match[3] == "up" {
+			s.up = string(b)
+		} else {
+			s.down = string(b)
+		}
+	}
+
+	var migrations []Migration
+	for version, s := range m {
+		if s.up == "" {
+			return nil, fmt.Errorf("ctxdb: migration %d has no up", version)
+		}
+		migrations = append(migrations, SQLMigration(version, s.name, s.up, s.down))
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements splits sql by ";" which is not in quotes or comments. Empty statements are dropped.
+func splitStatements(sql string) []string {
+	var statements []string
+	var b strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			statements = append(statements, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(sql) && (sql[end] != c || sql[end-1] == '\\') {
+				end++
+			}
+			if end == len(sql) {
+				end--
+			}
+			b.WriteString(sql[i : end+1])
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// migrationRecord is a row of the migration table, which is an applied migration.
+type migrationRecord struct {
+	Version   int64     `xorm:"'version' pk"`
+	Name      string    `xorm:"'name' varchar(255)"`
+	AppliedAt time.Time `xorm:"'applied_at'"`
+}
+
+// MigrationStatus is a migration, or a version which is applied but unknown to the migrator.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool
+}
+
+// Migrator applies migrations, and records the applied versions in the migration table.
+// The migrations are locked by a named lock of the database (MySQL GET_LOCK, PostgreSQL pg_advisory_lock),
+// so that migrators of several instances don't run at the same time.
+// Other databases are not locked, so only one migrator may run at a time.
+type Migrator struct {
+	engine      *xorm.Engine
+	migrations  []Migration
+	table       string
+	lockTimeout time.Duration
+}
+
+func NewMigrator(engine *xorm.Engine, migrations []Migration, options ...func(*Migrator)) (*Migrator, error) {
+	m := &Migrator{
+		engine:      engine,
+		migrations:  append([]Migration(nil), migrations...),
+		table:       DefaultMigrationTable,
+		lockTimeout: DefaultMigrationLockTimeout,
+	}
+	for _, option := range options {
+		if option != nil {
+			option(m)
+		}
+	}
+	sort.SliceStable(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	for i, migration := range m.migrations {
+		if migration.Up == nil {
+			return nil, fmt.Errorf("ctxdb: migration %d has no up", migration.Version)
+		}
+		if i > 0 && m.migrations[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("ctxdb: duplicate migration %d", migration.Version)
+		}
+	}
+	return m, nil
+}
+
+func MigrationTable(table string) func(*Migrator) {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// MigrationLockTimeout sets how long to wait for the lock of another migrator. It's not supported by PostgreSQL.
+func MigrationLockTimeout(d time.Duration) func(*Migrator) {
+	return func(m *Migrator) {
+		m.lockTimeout = d
+	}
+}
+
+// Up applies all pending migrations, including the ones older than the applied versions.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, -1)
+}
+
+// Down reverts the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(applied map[int64]migrationRecord) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.down(ctx, m.migrations[i])
+			}
+		}
+		return nil
+	})
+}
+
+// Goto applies the pending migrations up to version, and reverts the applied migrations after version.
+// Goto(ctx, 0) reverts all migrations, and a negative version applies all.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version > 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+	return m.withLock(ctx, func(applied map[int64]migrationRecord) error {
+		for i := len(m.migrations) - 1; i >= 0 && version >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; ok && migration.Version > version {
+				if err := m.down(ctx, migration); err != nil {
+					return err
+				}
+			}
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && (version < 0 || migration.Version <= version) {
+				if err := m.up(ctx, migration); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the migrations and whether they are applied, in the order of versions.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+	for _, record := range applied {
+		if m.index(record.Version) < 0 {
+			statuses = append(statuses, MigrationStatus{
+				Version:   record.Version,
+				Name:      record.Name,
+				Applied:   true,
+				AppliedAt: record.AppliedAt,
+				Unknown:   true,
+			})
+		}
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Run runs a command of args, so that it can be called by a CLI, e.g. migrator.Run(ctx, os.Stdout, os.Args[1:]...):
+//
+//	up          applies all pending migrations
+//	down        reverts the last applied migration
+//	goto VERSION  applies or reverts migrations to VERSION
+//	status      prints the migrations
+func (m *Migrator) Run(ctx context.Context, w io.Writer, args ...string) error {
+	if len(args) == 0 {
+		return errors.New("ctxdb: migration command is required: up, down, goto VERSION or status")
+	}
+	switch args[0] {
+	case "up":
+		if err := m.Up(ctx); err != nil {
+			return err
+		}
+	case "down":
+		if err := m.Down(ctx); err != nil {
+			return err
+		}
+	case "goto":
+		if len(args) < 2 {
+			return errors.New("ctxdb: version is required: goto VERSION")
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("ctxdb: invalid version %q", args[1])
+		}
+		if err := m.Goto(ctx, version); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("ctxdb: unknown migration command %q", args[0])
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		status, appliedAt := "pending", ""
+		if s.Applied {
+			status, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Unknown {
+			status = "applied (unknown)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+	}
+	return tw.Flush()
+}
+
+func (m *Migrator) index(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) up(ctx context.Context, migration Migration) error {
+	return m.run(ctx, migration, migration.Up, func(session *xorm.Session) error {
+		_, err := session.Table(m.table).Insert(&migrationRecord{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		})
+		return err
+	})
+}
+
+func (m *Migrator) down(ctx context.Context, migration Migration) error {
+	if migration.Down == nil {
+		return fmt.Errorf("%w: %d", ErrIrreversible, migration.Version)
+	}
+	return m.run(ctx, migration, migration.Down, func(session *xorm.Session) error {
+		_, err := session.Table(m.table).Where("version = ?", migration.Version).Delete(&migrationRecord{})
+		return err
+	})
+}
+
+func (m *Migrator) run(ctx context.Context, migration Migration, fn, record func(session *xorm.Session) error) error {
+	session := m.engine.NewSession()
+	defer session.Close()
+	session.Context(ctx)
+
+	err := runTx(ctx, func(context.Context) error {
+		if err := fn(session); err != nil {
+			return err
+		}
+		return record(session)
+	}, session.Begin, session.Commit, session.Rollback)
+	if err != nil {
+		return fmt.Errorf("ctxdb: migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	session := m.engine.NewSession()
+	defer session.Close()
+	session.Context(ctx)
+
+	exist, err := session.IsTableExist(m.table)
+	if err != nil || exist {
+		return err
+	}
+	return session.Table(m.table).CreateTable(&migrationRecord{})
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]migrationRecord, error) {
+	session := m.engine.NewSession()
+	defer session.Close()
+	session.Context(ctx)
+
+	var records []migrationRecord
+	if err := session.Table(m.table).Find(&records); err != nil {
+		return nil, err
+	}
+	applied := map[int64]migrationRecord{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// withLock runs fn with the applied migrations, holding the lock of the migration table.
+func (m *Migrator) withLock(ctx context.Context, fn func(applied map[int64]migrationRecord) error) (err error) {
+	// named locks belong to a connection, which is kept by a transaction. The transaction isn't bound to ctx,
+	// which would return the connection to the pool on cancellation, still holding the lock.
+	session := m.engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	defer session.Rollback()
+	session.Context(ctx)
+
+	name := "ctxdb_migrations_" + m.table
+	var lock, unlock string
+	var args []interface{}
+	switch m.engine.Dialect().URI().DBType {
+	case schemas.MYSQL:
+		lock, unlock = "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)"
+		// the timeout is in seconds, rounded up
+		timeout := int64(m.lockTimeout / time.Second)
+		if m.lockTimeout%time.Second > 0 {
+			timeout++
+		}
+		args = []interface{}{name, timeout}
+	case schemas.POSTGRES:
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		lock, unlock = "SELECT pg_advisory_lock(?)", "SELECT pg_advisory_unlock(?)"
+		args = []interface{}{int64(h.Sum64())}
+	}
+	if lock != "" {
+		results, err := session.QueryString(append([]interface{}{lock}, args...)...)
+		if err != nil {
+			return err
+		}
+		// GET_LOCK returns 1 if it's locked, 0 on timeout, and NULL on errors
+		if m.engine.Dialect().URI().DBType == schemas.MYSQL && !locked(results) {
+			return ErrMigrationLocked
+		}
+		defer func() {
+			session.Context(context.Background())
+			if _, unlockErr := session.QueryString(unlock, args[0]); unlockErr != nil && err == nil {
+				err = fmt.Errorf("ctxdb: failed to unlock migrations: %w", unlockErr)
+			}
+		}()
+	}
+
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(applied)
+}
+
+func locked(results []map[string]string) bool {
+	if len(results) != 1 {
+		return false
+	}
+	for _, v := range results[0] {
+		return v == "1"
+	}
+	return false
+}
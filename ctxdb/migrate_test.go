@@ -0,0 +1,154 @@
+package ctxdb_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/test"
+	"xorm.io/xorm"
+)
+
+func TestMigrator(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	var applied []int64
+	lock := "1"
+	fake.setRows(func(query string) ([]string, [][]driver.Value) {
+		switch {
+		case strings.HasPrefix(query, "SELECT GET_LOCK"):
+			return []string{"lock"}, [][]driver.Value{{lock}}
+		case strings.Contains(query, "INFORMATION_SCHEMA"):
+			return []string{"TABLE_NAME"}, [][]driver.Value{{"schema_migrations"}}
+		case strings.Contains(query, "FROM `schema_migrations`"):
+			var rows [][]driver.Value
+			for _, v := range applied {
+				rows = append(rows, []driver.Value{v, "", time.Now()})
+			}
+			return []string{"version", "name", "applied_at"}, rows
+		}
+		return nil, nil
+	})
+
+	exec := func(sql string) func(*xorm.Session) error {
+		return func(session *xorm.Session) error {
+			_, err := session.Exec(sql)
+			return err
+		}
+	}
+	migrator, err := ctxdb.NewMigrator(engine, []ctxdb.Migration{
+		{Version: 2, Name: "add_status", Up: exec("ALTER TABLE t ADD status"), Down: exec("ALTER TABLE t DROP status")},
+		ctxdb.SQLMigration(1, "create_t", "CREATE TABLE t (id int, name varchar(10) DEFAULT 'a;b'); -- comment;\nCREATE INDEX i ON t (name);", "DROP TABLE t"),
+		{Version: 3, Name: "seed", Up: exec("INSERT INTO t (id) VALUES (1)")},
+	})
+	test.Ok(t, err)
+	ctx := context.Background()
+
+	fake.Reset()
+	test.Ok(t, migrator.Up(ctx))
+	log := statements(fake.Log())
+	test.Assert(t, strings.HasPrefix(log, "BEGIN; SELECT GET_LOCK(?, ?)"), "migrations should be locked: %s", log)
+	test.Assert(t, strings.Contains(log, "CREATE TABLE t (id int, name varchar(10) DEFAULT 'a;b'); CREATE INDEX i ON t (name);"), "unexpected statements: %s", log)
+	test.Assert(t, strings.Index(log, "CREATE INDEX") < strings.Index(log, "ADD status"), "migrations should be applied in order: %s", log)
+	test.Assert(t, strings.Contains(log, "INSERT INTO t (id) VALUES (1)"), "unexpected statements: %s", log)
+	test.Equals(t, 3, strings.Count(log, "INSERT INTO `schema_migrations`"))
+	test.Assert(t, strings.HasSuffix(log, "SELECT RELEASE_LOCK(?); ROLLBACK"), "lock should be released: %s", log)
+
+	applied = []int64{1, 2, 3}
+	fake.Reset()
+	err = migrator.Down(ctx)
+	test.Assert(t, errors.Is(err, ctxdb.ErrIrreversible), "unexpected error: %v", err)
+
+	fake.Reset()
+	test.Ok(t, migrator.Goto(ctx, 3))
+	test.Assert(t, !strings.Contains(statements(fake.Log()), "INSERT"), "applied migrations should be skipped: %s", statements(fake.Log()))
+
+	applied = []int64{1, 2}
+	fake.Reset()
+	test.Ok(t, migrator.Down(ctx))
+	log = statements(fake.Log())
+	test.Assert(t, strings.Contains(log, "ALTER TABLE t DROP status"), "unexpected statements: %s", log)
+	test.Assert(t, strings.Contains(log, "DELETE FROM `schema_migrations` WHERE (version = ?)"), "unexpected statements: %s", log)
+	test.Assert(t, !strings.Contains(log, "DROP TABLE t"), "only the last migration should be reverted: %s", log)
+
+	fake.Reset()
+	test.Ok(t, migrator.Goto(ctx, 0))
+	log = statements(fake.Log())
+	test.Assert(t, strings.Index(log, "DROP status") < strings.Index(log, "DROP TABLE t"), "migrations should be reverted in reverse order: %s", log)
+
+	err = migrator.Goto(ctx, 4)
+	test.Assert(t, errors.Is(err, ctxdb.ErrUnknownMigration), "unexpected error: %v", err)
+
+	applied = []int64{1, 5}
+	var out bytes.Buffer
+	test.Ok(t, migrator.Run(ctx, &out, "status"))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	test.Equals(t, 5, len(lines))
+	test.Assert(t, strings.HasPrefix(lines[1], "1 ") && strings.Contains(lines[1], "applied"), "unexpected status: %s", lines[1])
+	test.Assert(t, strings.HasPrefix(lines[2], "2 ") && strings.Contains(lines[2], "pending"), "unexpected status: %s", lines[2])
+	test.Assert(t, strings.HasPrefix(lines[4], "5 ") && strings.Contains(lines[4], "applied (unknown)"), "unexpected status: %s", lines[4])
+
+	test.Assert(t, migrator.Run(ctx, &out, "sideways") != nil, "unknown command should fail")
+
+	lock = "0"
+	err = migrator.Up(ctx)
+	test.Equals(t, ctxdb.ErrMigrationLocked, err)
+
+	t.Run("cancel", func(t *testing.T) {
+		lock = "1"
+		applied = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		migrator, err := ctxdb.NewMigrator(engine, []ctxdb.Migration{
+			{Version: 1, Name: "cancel", Up: func(*xorm.Session) error {
+				cancel()
+				return context.Canceled
+			}},
+		}, ctxdb.MigrationLockTimeout(500*time.Millisecond))
+		test.Ok(t, err)
+
+		fake.Reset()
+		err = migrator.Up(ctx)
+		test.Assert(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+		// the timeout is rounded up to seconds
+		test.Equals(t, []interface{}{"ctxdb_migrations_schema_migrations", int64(1)}, fake.Args()[1])
+		// the lock is released though ctx is canceled
+		log := statements(fake.Log())
+		test.Assert(t, strings.HasSuffix(log, "SELECT RELEASE_LOCK(?); ROLLBACK"), "lock should be released: %s", log)
+	})
+}
+
+func TestLoadMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	test.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, sql := range map[string]string{
+		"2_add_status.up.sql":   "ALTER TABLE t ADD status",
+		"1_create_t.up.sql":     "CREATE TABLE t (id int)",
+		"1_create_t.down.sql":   "DROP TABLE t",
+		"README.md":             "migrations",
+		"3_other_name.down.sql": "",
+	} {
+		test.Ok(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(sql), 0644))
+	}
+	_, err = ctxdb.LoadMigrations(dir)
+	test.Assert(t, err != nil, "migration without up should fail")
+
+	test.Ok(t, os.Remove(filepath.Join(dir, "3_other_name.down.sql")))
+	migrations, err := ctxdb.LoadMigrations(dir)
+	test.Ok(t, err)
+	test.Equals(t, 2, len(migrations))
+	test.Equals(t, int64(1), migrations[0].Version)
+	test.Equals(t, "create_t", migrations[0].Name)
+	test.Assert(t, migrations[0].Down != nil, "down should be loaded")
+	test.Equals(t, "add_status", migrations[1].Name)
+	test.Assert(t, migrations[1].Down == nil, "down should be nil")
+}
@@ -0,0 +1,277 @@
+package ctxdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/kafka"
+	"xorm.io/xorm"
+)
+
+const (
+	DefaultOutboxTable        = "outbox"
+	DefaultOutboxBatchSize    = 100
+	DefaultOutboxPollInterval = time.Second
+	DefaultOutboxClaimTimeout = time.Minute
+)
+
+// OutboxEvent is a row of the outbox table. Create the table by engine.Sync2(new(ctxdb.OutboxEvent)).
+type OutboxEvent struct {
+	ID        int64     `json:"id" xorm:"'id' pk autoincr"`
+	Topic     string    `json:"topic" xorm:"varchar(255) notnull"`
+	Key       string    `json:"key,omitempty" xorm:"varchar(255)"`
+	Payload   string    `json:"payload" xorm:"text notnull"`
+	Headers   string    `json:"headers,omitempty" xorm:"text"`
+	Sent      bool      `json:"sent" xorm:"index notnull"`
+	CreatedAt time.Time `json:"createdAt" xorm:"created"`
+	SentAt    time.Time `json:"sentAt"`
+	// ClaimedBy is the OutboxRelay sending the event since ClaimedAt
+	ClaimedBy string    `json:"claimedBy,omitempty" xorm:"varchar(255)"`
+	ClaimedAt time.Time `json:"claimedAt"`
+}
+
+func (OutboxEvent) TableName() string {
+	return DefaultOutboxTable
+}
+
+// Context returns a context with the ctxbase.ContextBase of the request which published the event.
+func (e *OutboxEvent) Context(ctx context.Context) context.Context {
+	headers := outboxHeaders{}
+	if e.Headers != "" {
+		json.Unmarshal([]byte(e.Headers), &headers)
+	}
+	return ctxbase.Extract(headers).ToCtx(ctx)
+}
+
+// outboxHeaders is a ctxbase.Carrier of the headers of an event.
+type outboxHeaders map[string]string
+
+func (h outboxHeaders) Get(key string) string { return h[key] }
+func (h outboxHeaders) Set(key, value string) { h[key] = value }
+
+// Publish inserts an event into the outbox by the session in ctx, so that it's sent only if the transaction is committed.
+// v is sent as JSON to topic by an OutboxRelay, with the request ID and trace of ctx.
+// If the session is of a replica, e.g. in a GET request, the event is inserted by a new session of the primary.
+func Publish(ctx context.Context, topic string, v interface{}, key ...string) error {
+	session := FromCtx(ctx)
+	if session == nil {
+		return ErrNoSession
+	}
+	if db := primaryOf(session); db != nil {
+		session = db.NewSession(WithReadOnly(ctx, false))
+		defer session.Close()
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	event := &OutboxEvent{
+		Topic:   topic,
+		Payload: string(payload),
+	}
+	if len(key) != 0 {
+		event.Key = key[0]
+	}
+	if cb := ctxbase.FromCtx(ctx); cb != nil {
+		headers := outboxHeaders{}
+		cb.Inject(headers)
+		b, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+		event.Headers = string(b)
+	}
+	_, err = session.Insert(event)
+	return err
+}
+
+// OutboxPublisher sends an event of the outbox. The event is marked sent if it returns nil.
+type OutboxPublisher func(ctx context.Context, event *OutboxEvent) error
+
+// KafkaPublisher sends events to the producer of their topic, and waits until they are acknowledged.
+func KafkaPublisher(producers ...*kafka.Producer) OutboxPublisher {
+	m := map[string]*kafka.Producer{}
+	for _, p := range producers {
+		m[p.Topic()] = p
+	}
+	return func(ctx context.Context, event *OutboxEvent) error {
+		p, ok := m[event.Topic]
+		if !ok {
+			return fmt.Errorf("ctxdb: no producer of topic %q", event.Topic)
+		}
+		var err error
+		if event.Key != "" {
+			_, _, err = p.SendWithKeySync(ctx, json.RawMessage(event.Payload), event.Key)
+		} else {
+			_, _, err = p.SendSync(ctx, json.RawMessage(event.Payload))
+		}
+		return err
+	}
+}
+
+// OutboxRelay polls the outbox and sends the events in order.
+//
+// Every poll claims a batch of events in a short transaction, sends them without holding locks, and then marks them sent.
+// Several relays can run at the same time: while the first unsent events are claimed by a relay, the others don't poll
+// the following events, so that the order is kept. A claim expires after the claim timeout, e.g. if the relay crashed,
+// and the events are sent again by another relay.
+type OutboxRelay struct {
+	engine       *xorm.Engine
+	publish      OutboxPublisher
+	batchSize    int
+	pollInterval time.Duration
+	claimTimeout time.Duration
+	// id is the ClaimedBy of the events claimed by the relay
+	id string
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewOutboxRelay(engine *xorm.Engine, publish OutboxPublisher, options ...func(*OutboxRelay)) *OutboxRelay {
+	r := &OutboxRelay{
+		engine:       engine,
+		publish:      publish,
+		batchSize:    DefaultOutboxBatchSize,
+		pollInterval: DefaultOutboxPollInterval,
+		claimTimeout: DefaultOutboxClaimTimeout,
+		id:           ctxbase.NewID(),
+	}
+	for _, option := range options {
+		if option != nil {
+			option(r)
+		}
+	}
+	return r
+}
+
+func OutboxBatchSize(n int) func(*OutboxRelay) {
+	return func(r *OutboxRelay) {
+		r.batchSize = n
+	}
+}
+
+func OutboxPollInterval(d time.Duration) func(*OutboxRelay) {
+	return func(r *OutboxRelay) {
+		r.pollInterval = d
+	}
+}
+
+// OutboxClaimTimeout sets how long events claimed by a relay are not sent by the others.
+// It must be longer than sending a batch takes. The default is DefaultOutboxClaimTimeout.
+func OutboxClaimTimeout(d time.Duration) func(*OutboxRelay) {
+	return func(r *OutboxRelay) {
+		r.claimTimeout = d
+	}
+}
+
+// Start polls the outbox in the background until Stop is called.
+// A full batch is followed by the next poll immediately, otherwise the relay waits for the poll interval.
+func (r *OutboxRelay) Start() {
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			n, err := r.Relay(context.Background())
+			if err != nil {
+				log.Println("ctxdb: failed to relay outbox:", err)
+			}
+			wait := r.pollInterval
+			if err == nil && n == r.batchSize {
+				wait = 0
+			}
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop stops polling, and waits for the current poll.
+func (r *OutboxRelay) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		r.wg.Wait()
+		r.stop = nil
+	}
+}
+
+// Relay sends a batch of events, and returns the number of events sent.
+// It stops at the first event failing to send, so that the order is kept; the events sent before it are still marked,
+// and the claim of the others is released.
+func (r *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	events, err := r.claim(ctx)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	var sent, unsent []int64
+	var publishErr error
+	for i := range events {
+		if publishErr == nil {
+			publishErr = r.publish(events[i].Context(ctx), &events[i])
+		}
+		if publishErr == nil {
+			sent = append(sent, events[i].ID)
+		} else {
+			unsent = append(unsent, events[i].ID)
+		}
+	}
+
+	session := r.engine.NewSession()
+	defer session.Close()
+	session.Context(ctx)
+	if len(sent) != 0 {
+		if _, err := session.In("id", sent).Cols("sent", "sent_at").Update(&OutboxEvent{Sent: true, SentAt: time.Now()}); err != nil {
+			return 0, err
+		}
+	}
+	if len(unsent) != 0 {
+		if _, err := session.In("id", unsent).And("claimed_by = ?", r.id).Cols("claimed_by").Update(&OutboxEvent{}); err != nil {
+			log.Println("ctxdb: failed to release outbox events:", err)
+		}
+	}
+	return len(sent), publishErr
+}
+
+// claim returns a batch of unsent events claimed by the relay, or none if the first of them are claimed by another relay.
+func (r *OutboxRelay) claim(ctx context.Context) ([]OutboxEvent, error) {
+	session := r.engine.NewSession()
+	defer session.Close()
+	session.Context(ctx)
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	var events []OutboxEvent
+	if err := session.Where("sent = ?", false).Asc("id").Limit(r.batchSize).ForUpdate().Find(&events); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	now := time.Now()
+	var ids []int64
+	for _, event := range events {
+		if event.ClaimedBy != "" && event.ClaimedBy != r.id && now.Sub(event.ClaimedAt) < r.claimTimeout {
+			return nil, session.Rollback()
+		}
+		ids = append(ids, event.ID)
+	}
+	if len(ids) != 0 {
+		if _, err := session.In("id", ids).Cols("claimed_by", "claimed_at").Update(&OutboxEvent{ClaimedBy: r.id, ClaimedAt: now}); err != nil {
+			session.Rollback()
+			return nil, err
+		}
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
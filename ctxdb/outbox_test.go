@@ -0,0 +1,139 @@
+package ctxdb_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestPublish(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	db := ctxdb.New(engine, "test", kafka.Config{})
+	session := db.NewSession(context.Background())
+	defer session.Close()
+
+	cb := ctxbase.New("request-1", "", "")
+	ctx := ctxdb.ToCtx(cb.ToCtx(context.Background()), session)
+
+	err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+		return ctxdb.Publish(ctx, "order", map[string]interface{}{"id": 1}, "order-1")
+	})
+	test.Ok(t, err)
+
+	log := fake.Log()
+	test.Equals(t, 3, len(log))
+	test.Assert(t, strings.HasPrefix(log[1], "INSERT INTO `outbox`"), "unexpected statement: %s", log[1])
+	test.Equals(t, "COMMIT", log[2])
+	args := fake.Args()[1]
+	test.Equals(t, "order", args[0])
+	test.Equals(t, "order-1", args[1])
+	test.Equals(t, `{"id":1}`, args[2])
+	test.Assert(t, strings.Contains(args[3].(string), "request-1"), "request ID should be in the headers: %v", args[3])
+
+	fake.Reset()
+	err = ctxdb.WithTx(ctx, func(ctx context.Context) error {
+		if err := ctxdb.Publish(ctx, "order", 1); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+	test.Equals(t, "failed", err.Error())
+	test.Equals(t, "ROLLBACK", fake.Log()[2])
+
+	test.Equals(t, ctxdb.ErrNoSession, ctxdb.Publish(context.Background(), "order", 1))
+}
+
+func TestPublishReadOnly(t *testing.T) {
+	primary, fake := newFakeEngine(t, "primary")
+	replica, replicaFake := newFakeEngine(t, "replica")
+	db := ctxdb.New(primary, "test", kafka.Config{}, ctxdb.Replicas(replica))
+	defer db.Close()
+
+	// GET requests have a session of a replica
+	ctx := ctxdb.WithReadOnly(context.Background(), true)
+	session := db.NewSession(ctx)
+	defer session.Close()
+	test.Equals(t, replica, session.Engine())
+
+	test.Ok(t, ctxdb.Publish(ctxdb.ToCtx(ctx, session), "order", 1))
+	test.Equals(t, 0, len(replicaFake.Log()))
+	test.Equals(t, 1, len(fake.Log()))
+	test.Assert(t, strings.HasPrefix(fake.Log()[0], "INSERT INTO `outbox`"), "unexpected statement: %s", fake.Log()[0])
+}
+
+func TestOutboxRelay(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	now := time.Now()
+	headers := `{"X-Request-ID":"request-1"}`
+	claimedBy := ""
+	fake.setRows(func(query string) ([]string, [][]driver.Value) {
+		if !strings.Contains(query, "FROM `outbox`") {
+			return nil, nil
+		}
+		return []string{"id", "topic", "key", "payload", "headers", "sent", "created_at", "sent_at", "claimed_by", "claimed_at"}, [][]driver.Value{
+			{int64(1), "order", "", `{"id":1}`, headers, int64(0), now, nil, claimedBy, now},
+			{int64(2), "order", "order-2", `{"id":2}`, "", int64(0), now, nil, claimedBy, now},
+			{int64(3), "unknown", "", `{"id":3}`, "", int64(0), now, nil, claimedBy, now},
+		}
+	})
+
+	var sent []string
+	relay := ctxdb.NewOutboxRelay(engine, func(ctx context.Context, event *ctxdb.OutboxEvent) error {
+		// the claim is committed before the events are sent
+		log := fake.Log()
+		test.Equals(t, "COMMIT", log[len(log)-1])
+		if event.Topic != "order" {
+			return errors.New("unknown topic")
+		}
+		if event.ID == 1 {
+			test.Equals(t, "request-1", ctxbase.FromCtx(ctx).RequestID)
+		}
+		sent = append(sent, event.Payload)
+		return nil
+	}, ctxdb.OutboxBatchSize(10))
+
+	n, err := relay.Relay(context.Background())
+	test.Equals(t, "unknown topic", err.Error())
+	test.Equals(t, 2, n)
+	test.Equals(t, []string{`{"id":1}`, `{"id":2}`}, sent)
+
+	log := fake.Log()
+	test.Equals(t, 6, len(log))
+	test.Equals(t, "BEGIN", log[0])
+	test.Assert(t, strings.Contains(log[1], "ORDER BY `id` ASC LIMIT 10 FOR UPDATE"), "events should be locked in order: %s", log[1])
+	test.Assert(t, strings.HasPrefix(log[2], "UPDATE `outbox` SET `claimed_by` = ?, `claimed_at` = ? WHERE `id` IN (?,?,?)"), "unexpected statement: %s", log[2])
+	test.Equals(t, "COMMIT", log[3])
+	test.Assert(t, strings.HasPrefix(log[4], "UPDATE `outbox` SET `sent` = ?, `sent_at` = ? WHERE `id` IN (?,?)"), "unexpected statement: %s", log[4])
+	test.Equals(t, []interface{}{int64(1), int64(2)}, fake.Args()[4][2:])
+	// the claim of the unsent event is released
+	test.Assert(t, strings.HasPrefix(log[5], "UPDATE `outbox` SET `claimed_by` = ? WHERE `id` IN (?) AND (claimed_by = ?)"), "unexpected statement: %s", log[5])
+	test.Equals(t, []interface{}{"", int64(3)}, fake.Args()[5][:2])
+
+	t.Run("claimed by another relay", func(t *testing.T) {
+		fake.Reset()
+		sent = nil
+		claimedBy = "another"
+		n, err := relay.Relay(context.Background())
+		test.Ok(t, err)
+		test.Equals(t, 0, n)
+		test.Equals(t, 0, len(sent))
+		test.Equals(t, "ROLLBACK", fake.Log()[2])
+
+		// the claim expired
+		fake.Reset()
+		expired := ctxdb.NewOutboxRelay(engine, func(ctx context.Context, event *ctxdb.OutboxEvent) error {
+			return nil
+		}, ctxdb.OutboxClaimTimeout(time.Nanosecond))
+		n, err = expired.Relay(context.Background())
+		test.Ok(t, err)
+		test.Equals(t, 3, n)
+	})
+}
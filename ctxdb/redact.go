@@ -0,0 +1,243 @@
+package ctxdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Actions of redaction rules.
+const (
+	RedactMask = "mask" // the arg is replaced by "******"
+	RedactHash = "hash" // the arg is replaced by "hmac:" and the first 32 hex digits of its HMAC-SHA256, so that it can still be compared
+	RedactDrop = "drop" // the arg is removed, and the following args are shifted
+)
+
+const redactMasked = "******"
+
+// RedactRule redacts the args bound to Column of Table, in SQL matching Pattern.
+// Empty fields (or "*" for Table and Column) match anything, so a rule with only Pattern redacts all args of the SQL.
+// Names are case-insensitive. It can be read from the service config, e.g.
+//
+//	redact:
+//	  key: secret-of-the-service
+//	  rules:
+//	  - {table: member, column: mobile, action: mask}
+//	  - {column: password, action: drop}
+//	  - {pattern: "(?i)card_token", action: hash}
+type RedactRule struct {
+	Table   string
+	Column  string
+	Pattern string
+	Action  string // mask (default), hash or drop
+
+	pattern *regexp.Regexp
+}
+
+// Redactor redacts the args and errors of SQL logs.
+type Redactor struct {
+	key   []byte
+	rules []RedactRule
+}
+
+// NewRedactor returns a Redactor of rules. key is the secret key of RedactHash, which is required by hash rules.
+//
+// Hashed args are keyed, because the logs are read by more people than the database, and values like mobile numbers
+// are too few to hide by a plain hash: anyone reading the logs could hash all of them and look the args up.
+// With the HMAC, readers can only tell equal args apart, as long as the key (e.g. in the service config or a secret)
+// is not readable by them. Use a different key per service, and mask args which don't need to be compared.
+func NewRedactor(key string, rules ...RedactRule) (*Redactor, error) {
+	r := &Redactor{key: []byte(key)}
+	for _, rule := range rules {
+		rule.Table, rule.Column = strings.ToLower(rule.Table), strings.ToLower(rule.Column)
+		switch rule.Action = strings.ToLower(rule.Action); rule.Action {
+		case "":
+			rule.Action = RedactMask
+		case RedactMask, RedactDrop:
+		case RedactHash:
+			if key == "" {
+				return nil, fmt.Errorf("ctxdb: redact action %q requires a key", rule.Action)
+			}
+		default:
+			return nil, fmt.Errorf("ctxdb: unknown redact action %q", rule.Action)
+		}
+		if rule.Pattern != "" {
+			p, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("ctxdb: invalid redact pattern: %w", err)
+			}
+			rule.pattern = p
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// WithRedactor redacts the args and errors of SQL logs before they are written to the sinks.
+func WithRedactor(r *Redactor) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.redactor = r
+	}
+}
+
+// Redact returns a redacted copy of args. args is never changed.
+func (r *Redactor) Redact(sql string, args []interface{}) []interface{} {
+	if r == nil || len(r.rules) == 0 || len(args) == 0 {
+		return args
+	}
+	rules := r.rulesOf(sql)
+	if len(rules) == 0 {
+		return args
+	}
+
+	table, columns := parseSQLArgs(sql)
+	redacted := make([]interface{}, 0, len(args))
+	for i, arg := range args {
+		var column string
+		if i < len(columns) {
+			column = columns[i]
+		}
+		action := ""
+		for _, rule := range rules {
+			if rule.matches(table, column) {
+				action = rule.Action
+				break
+			}
+		}
+		switch action {
+		case RedactMask:
+			redacted = append(redacted, redactMasked)
+		case RedactHash:
+			mac := hmac.New(sha256.New, r.key)
+			mac.Write([]byte(fmt.Sprint(arg)))
+			redacted = append(redacted, "hmac:"+hex.EncodeToString(mac.Sum(nil)[:16]))
+		case RedactDrop:
+		default:
+			redacted = append(redacted, arg)
+		}
+	}
+	return redacted
+}
+
+// RedactError returns msg, the error of sql, with its quoted literals masked if any rule matches the table or columns of sql.
+// Driver errors may contain the values of the SQL, e.g. "Duplicate entry '13800000000' for key 'mobile'" of MySQL.
+func (r *Redactor) RedactError(sql, msg string) string {
+	if r == nil {
+		return msg
+	}
+	rules := r.rulesOf(sql)
+	if len(rules) == 0 {
+		return msg
+	}
+	table, columns := parseSQLArgs(sql)
+	for _, rule := range rules {
+		matched := rule.matches(table, "")
+		for _, column := range columns {
+			matched = matched || rule.matches(table, column)
+		}
+		if matched {
+			return sqlQuotedPattern.ReplaceAllString(msg, "'"+redactMasked+"'")
+		}
+	}
+	return msg
+}
+
+// rulesOf returns the rules whose pattern matches sql.
+func (r *Redactor) rulesOf(sql string) []RedactRule {
+	var rules []RedactRule
+	for _, rule := range r.rules {
+		if rule.pattern == nil || rule.pattern.MatchString(sql) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (rule RedactRule) matches(table, column string) bool {
+	if rule.Table != "" && rule.Table != "*" && rule.Table != table {
+		return false
+	}
+	if rule.Column != "" && rule.Column != "*" && rule.Column != column {
+		return false
+	}
+	return true
+}
+
+var (
+	sqlTablePattern  = regexp.MustCompile("(?is)^\\s*(?:INSERT\\s+(?:IGNORE\\s+)?INTO|REPLACE\\s+INTO|UPDATE|DELETE\\s+FROM|SELECT\\s.*?\\sFROM)\\s+([`\"\\w.]+)")
+	sqlInsertPattern = regexp.MustCompile("(?is)^\\s*(?:INSERT\\s+(?:IGNORE\\s+)?|REPLACE\\s+)INTO\\s+[`\"\\w.]+\\s*\\(([^)]*)\\)\\s*VALUES")
+	sqlTokenPattern  = regexp.MustCompile("`[^`]*`|\"[^\"]*\"|'(?:[^']|'')*'|[\\w.]+|\\?|\\S")
+	sqlQuotedPattern = regexp.MustCompile("'(?:[^'\\\\]|\\\\.|'')*'")
+)
+
+// sqlKeywords are words which are not column names.
+var sqlKeywords = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`and or not in is null like between exists select from where set values
+		order by group having limit offset as on join left right inner outer case when then else end asc desc
+		distinct union all any true false interval`) {
+		sqlKeywords[k] = true
+	}
+}
+
+// parseSQLArgs returns the table of sql (lowercase, without the schema and quotes), and the column each placeholder is bound to.
+// It understands the SQL generated by xorm, e.g. "INSERT INTO t (a, b) VALUES (?, ?)" and "UPDATE t SET a = ? WHERE b IN (?, ?)".
+// The column of a placeholder is the last column name before it, or "" if unknown.
+func parseSQLArgs(sql string) (string, []string) {
+	var table string
+	if m := sqlTablePattern.FindStringSubmatch(sql); m != nil {
+		table = unquoteIdentifier(m[1])
+	}
+
+	if m := sqlInsertPattern.FindStringSubmatchIndex(sql); m != nil {
+		var names []string
+		for _, name := range strings.Split(sql[m[2]:m[3]], ",") {
+			names = append(names, unquoteIdentifier(name))
+		}
+		var columns []string
+		for _, token := range sqlTokenPattern.FindAllString(sql[m[1]:], -1) {
+			if token == "?" {
+				columns = append(columns, names[len(columns)%len(names)])
+			}
+		}
+		return table, columns
+	}
+
+	var columns []string
+	var last string
+	tokens := sqlTokenPattern.FindAllString(sql, -1)
+	for i, token := range tokens {
+		switch {
+		case token == "?":
+			columns = append(columns, last)
+		case token[0] == '\'':
+			// string literal
+		case token[0] == '`' || token[0] == '"' || token[0] == '_' || isLetter(token[0]):
+			if sqlKeywords[strings.ToLower(token)] && token[0] != '`' && token[0] != '"' {
+				continue
+			}
+			// function names are followed by "("
+			if i+1 < len(tokens) && tokens[i+1] == "(" && token[0] != '`' && token[0] != '"' {
+				continue
+			}
+			last = unquoteIdentifier(token)
+		}
+	}
+	return table, columns
+}
+
+func unquoteIdentifier(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '.'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.ToLower(strings.Trim(s, "`\""))
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
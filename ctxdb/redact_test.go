@@ -0,0 +1,113 @@
+package ctxdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := ctxdb.NewRedactor("secret",
+		ctxdb.RedactRule{Table: "member", Column: "mobile"},
+		ctxdb.RedactRule{Column: "password", Action: "drop"},
+		ctxdb.RedactRule{Table: "*", Column: "card_token", Action: "hash"},
+		ctxdb.RedactRule{Pattern: "(?i)^UPDATE `secret`", Action: "mask"},
+	)
+	test.Ok(t, err)
+
+	hash := r.Redact("SELECT * FROM t WHERE card_token = ?", []interface{}{"tok_123"})[0]
+	test.Equals(t, hash, r.Redact("SELECT * FROM t WHERE card_token = ?", []interface{}{"tok_123"})[0])
+	test.Assert(t, hash != "tok_123", "card_token should be hashed")
+
+	for _, c := range []struct {
+		sql            string
+		args, redacted []interface{}
+	}{
+		{
+			"INSERT INTO `member` (`name`,`mobile`,`password`) VALUES (?,?,?),(?,?,?)",
+			[]interface{}{"a", "13800000000", "x", "b", "13900000000", "y"},
+			[]interface{}{"a", "******", "b", "******"},
+		},
+		{
+			"UPDATE `member` SET `name` = ?, `mobile`=? WHERE `id`=? AND `mobile` IN (?,?)",
+			[]interface{}{"a", "1", 10, "2", "3"},
+			[]interface{}{"a", "******", 10, "******", "******"},
+		},
+		{
+			"SELECT `id`, `name` FROM `db`.`member` WHERE (LOWER(`member`.`mobile`) = ?) AND name LIKE 'a?' AND age BETWEEN ? AND ? LIMIT 10",
+			[]interface{}{"1", 10, 20},
+			[]interface{}{"******", 10, 20},
+		},
+		{
+			// mobile of other tables is not redacted
+			"SELECT * FROM store WHERE mobile = ? AND card_token = ?",
+			[]interface{}{"1", "tok_123"},
+			[]interface{}{"1", hash},
+		},
+		{
+			"DELETE FROM member WHERE password = ? AND id = ?",
+			[]interface{}{"x", 1},
+			[]interface{}{1},
+		},
+		{
+			"UPDATE `secret` SET `value` = ? WHERE `id` = ?",
+			[]interface{}{"s", 1},
+			[]interface{}{"******", "******"},
+		},
+	} {
+		args := append([]interface{}(nil), c.args...)
+		test.Equals(t, c.redacted, r.Redact(c.sql, args))
+		test.Equals(t, c.args, args)
+	}
+
+	// hashes depend on the key
+	other, err := ctxdb.NewRedactor("other", ctxdb.RedactRule{Column: "card_token", Action: "hash"})
+	test.Ok(t, err)
+	test.Assert(t, hash != other.Redact("SELECT * FROM t WHERE card_token = ?", []interface{}{"tok_123"})[0], "hashes should be keyed")
+
+	_, err = ctxdb.NewRedactor("", ctxdb.RedactRule{Column: "a", Action: "hash"})
+	test.Assert(t, err != nil, "hash without a key should fail")
+	_, err = ctxdb.NewRedactor("", ctxdb.RedactRule{Column: "a", Action: "encrypt"})
+	test.Assert(t, err != nil, "unknown action should fail")
+	_, err = ctxdb.NewRedactor("", ctxdb.RedactRule{Pattern: "("})
+	test.Assert(t, err != nil, "invalid pattern should fail")
+}
+
+func TestRedactSqlLog(t *testing.T) {
+	engine, _ := newFakeEngine(t)
+	sink := ctxdb.NewMemorySink()
+	r, err := ctxdb.NewRedactor("", ctxdb.RedactRule{Table: "member", Column: "mobile"})
+	test.Ok(t, err)
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.WithSqlLogSink(sink), ctxdb.WithRedactor(r))
+
+	session := db.NewSession(context.Background())
+	defer session.Close()
+	_, err = session.Exec("UPDATE member SET mobile = ? WHERE id = ?", "13800000000", 1)
+	test.Ok(t, err)
+
+	test.Equals(t, []interface{}{"******", 1}, sink.Logs()[0].Args)
+
+	t.Run("error", func(t *testing.T) {
+		engine, fake := newFakeEngine(t)
+		sink := ctxdb.NewMemorySink()
+		db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.WithSqlLogSink(sink), ctxdb.WithRedactor(r))
+		fake.setFail(func(query string) error {
+			return errors.New("Error 1062: Duplicate entry '13800000000' for key 'mobile'")
+		})
+
+		session := db.NewSession(context.Background())
+		defer session.Close()
+		_, err := session.Exec("INSERT INTO member (name, mobile) VALUES (?, ?)", "kim", "13800000000")
+		test.Assert(t, err != nil, "expected the duplicate entry error")
+		_, err = session.Exec("INSERT INTO store (name, code) VALUES (?, ?)", "main", "13800000000")
+		test.Assert(t, err != nil, "expected the duplicate entry error")
+
+		logs := sink.Logs()
+		test.Equals(t, "Error 1062: Duplicate entry '******' for key '******'", logs[0].Error)
+		test.Equals(t, "Error 1062: Duplicate entry '13800000000' for key 'mobile'", logs[1].Error)
+	})
+}
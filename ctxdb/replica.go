@@ -0,0 +1,158 @@
+package ctxdb
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"xorm.io/xorm"
+)
+
+const (
+	DefaultHealthCheckInterval = 5 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+)
+
+// ReplicaPolicy chooses one of the healthy replicas, which are never empty.
+type ReplicaPolicy func(replicas []*xorm.Engine) *xorm.Engine
+
+// RoundRobin chooses replicas in turn. It's the default policy.
+func RoundRobin() ReplicaPolicy {
+	var n uint64
+	return func(replicas []*xorm.Engine) *xorm.Engine {
+		return replicas[int((atomic.AddUint64(&n, 1)-1)%uint64(len(replicas)))]
+	}
+}
+
+// LeastConn chooses the replica with the least connections in use.
+func LeastConn() ReplicaPolicy {
+	return func(replicas []*xorm.Engine) *xorm.Engine {
+		chosen, least := replicas[0], replicas[0].DB().Stats().InUse
+		for _, r := range replicas[1:] {
+			if inUse := r.DB().Stats().InUse; inUse < least {
+				chosen, least = r, inUse
+			}
+		}
+		return chosen
+	}
+}
+
+// Replicas adds read replicas, which are used by sessions of read-only contexts (see WithReadOnly).
+func Replicas(replicas ...*xorm.Engine) func(*ContextDB) {
+	return func(db *ContextDB) {
+		for _, r := range replicas {
+			db.replicas = append(db.replicas, &replica{Engine: r, index: len(db.replicas), healthy: 1})
+		}
+	}
+}
+
+func WithReplicaPolicy(policy ReplicaPolicy) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.policy = policy
+	}
+}
+
+// HealthCheck sets how often replicas are pinged. A replica failing the ping is ejected until it passes again.
+func HealthCheck(interval, timeout time.Duration) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.healthCheckInterval = interval
+		db.healthCheckTimeout = timeout
+	}
+}
+
+type replica struct {
+	*xorm.Engine
+	index   int
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+type readOnlyKey struct{}
+
+// WithReadOnly marks ctx read-only or not. Sessions of read-only contexts go to a replica.
+func WithReadOnly(ctx context.Context, readOnly bool) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, readOnly)
+}
+
+// ReadOnlyFromCtx returns whether ctx is read-only, and whether it's marked by WithReadOnly.
+func ReadOnlyFromCtx(ctx context.Context) (readOnly, ok bool) {
+	if ctx == nil {
+		return false, false
+	}
+	readOnly, ok = ctx.Value(readOnlyKey{}).(bool)
+	return
+}
+
+// replicaEngines maps replicas to their ContextDB, so that WithTx can move a transaction to the primary.
+var replicaEngines sync.Map
+
+func primaryOf(session *xorm.Session) *ContextDB {
+	if db, ok := replicaEngines.Load(session.Engine()); ok {
+		return db.(*ContextDB)
+	}
+	return nil
+}
+
+// replica returns a healthy replica chosen by the policy, or nil.
+func (db *ContextDB) replica() *xorm.Engine {
+	if len(db.replicas) == 0 {
+		return nil
+	}
+	healthy := make([]*xorm.Engine, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		if r.isHealthy() {
+			healthy = append(healthy, r.Engine)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return db.policy(healthy)
+}
+
+func (db *ContextDB) startHealthCheck() {
+	db.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(db.healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.stop:
+				return
+			case <-ticker.C:
+				db.checkHealth()
+			}
+		}
+	}()
+}
+
+func (db *ContextDB) checkHealth() {
+	var wg sync.WaitGroup
+	for _, r := range db.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), db.healthCheckTimeout)
+			defer cancel()
+
+			var healthy int32 = 1
+			err := r.PingContext(ctx)
+			if err != nil {
+				healthy = 0
+			}
+			if old := atomic.SwapInt32(&r.healthy, healthy); old != healthy {
+				if err != nil {
+					log.Printf("ctxdb: replica %d is ejected: %v\n", r.index, err)
+				} else {
+					log.Printf("ctxdb: replica %d is back\n", r.index)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+}
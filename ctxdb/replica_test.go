@@ -0,0 +1,87 @@
+package ctxdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+	"xorm.io/xorm"
+)
+
+func TestReplicas(t *testing.T) {
+	primary, _ := newFakeEngine(t, "primary")
+	replica1, db1 := newFakeEngine(t, "replica1")
+	replica2, _ := newFakeEngine(t, "replica2")
+	db := ctxdb.New(primary, "test", kafka.Config{},
+		ctxdb.Replicas(replica1, replica2),
+		ctxdb.HealthCheck(10*time.Millisecond, time.Second),
+	)
+	defer db.Close()
+
+	engineOf := func(ctx context.Context) *xorm.Engine {
+		session := db.NewSession(ctx)
+		defer session.Close()
+		return session.Engine()
+	}
+	readOnly := ctxdb.WithReadOnly(context.Background(), true)
+
+	t.Run("route", func(t *testing.T) {
+		test.Equals(t, primary, engineOf(context.Background()))
+		test.Equals(t, primary, engineOf(ctxdb.WithReadOnly(context.Background(), false)))
+		test.Equals(t, replica1, engineOf(readOnly))
+		test.Equals(t, replica2, engineOf(readOnly))
+		test.Equals(t, replica1, engineOf(readOnly))
+	})
+
+	t.Run("eject", func(t *testing.T) {
+		db1.setFail(func(query string) error {
+			if query == "PING" {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+		waitFor(t, func() bool { return engineOf(readOnly) == replica2 && engineOf(readOnly) == replica2 })
+
+		db1.setFail(nil)
+		waitFor(t, func() bool { return engineOf(readOnly) == replica1 || engineOf(readOnly) == replica1 })
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		session := db.NewSession(readOnly)
+		defer session.Close()
+		ctx := ctxdb.ToCtx(readOnly, session)
+
+		var engine *xorm.Engine
+		test.Ok(t, ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			engine = ctxdb.FromCtx(ctx).Engine()
+			return nil
+		}))
+		test.Equals(t, primary, engine)
+	})
+}
+
+func TestLeastConn(t *testing.T) {
+	replica1, _ := newFakeEngine(t, "replica1")
+	replica2, _ := newFakeEngine(t, "replica2")
+
+	conn, err := replica1.DB().Conn(context.Background())
+	test.Ok(t, err)
+	defer conn.Close()
+
+	policy := ctxdb.LeastConn()
+	test.Equals(t, replica2, policy([]*xorm.Engine{replica1, replica2}))
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
@@ -0,0 +1,173 @@
+package ctxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+const (
+	DefaultRetryMinBackoff = 10 * time.Millisecond
+	DefaultRetryMaxBackoff = time.Second
+)
+
+// retryableErrorNumbers are MySQL errors of which the transaction can be retried:
+// ER_LOCK_WAIT_TIMEOUT and ER_LOCK_DEADLOCK.
+var retryableErrorNumbers = map[uint64]bool{
+	1205: true,
+	1213: true,
+}
+
+// retryableSQLStates are PostgreSQL errors of which the transaction can be retried:
+// serialization_failure and deadlock_detected.
+var retryableSQLStates = map[string]bool{
+	"40001": true,
+	"40P01": true,
+}
+
+// IsRetryable reports whether err (or an error it wraps) is a deadlock, a lock wait timeout or a serialization failure,
+// of which the transaction can be retried.
+// Drivers are not imported: errors are recognized by the Number field (go-sql-driver/mysql), the Code field (lib/pq),
+// or the SQLState method (pgx).
+func IsRetryable(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(interface{ SQLState() string }); ok && retryableSQLStates[e.SQLState()] {
+			return true
+		}
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		if f := v.FieldByName("Number"); f.IsValid() {
+			switch f.Kind() {
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				if retryableErrorNumbers[f.Uint()] {
+					return true
+				}
+			}
+		}
+		if f := v.FieldByName("Code"); f.IsValid() && f.Kind() == reflect.String && retryableSQLStates[f.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry re-runs the transaction of WithTx up to maxRetries times if it fails with a retryable error (see IsRetryable).
+// Before every retry, the transaction is rolled back, and WithTx waits for an exponential backoff with jitter.
+// Only the outermost transaction is retried, since a deadlock rolls back the whole transaction.
+func Retry(maxRetries int) func(*TxOptions) {
+	return func(o *TxOptions) {
+		o.MaxRetries = maxRetries
+	}
+}
+
+// RetryBackoff sets the backoff of the first retry, which is doubled for every retry up to max.
+func RetryBackoff(min, max time.Duration) func(*TxOptions) {
+	return func(o *TxOptions) {
+		o.MinBackoff, o.MaxBackoff = min, max
+	}
+}
+
+// RetryIf sets which errors are retried. The default is IsRetryable.
+func RetryIf(retryable func(error) bool) func(*TxOptions) {
+	return func(o *TxOptions) {
+		o.Retryable = retryable
+	}
+}
+
+// TxRetry sets the retry policy of the transactions of requests, which are re-run by RetryTx, e.g. in echomiddleware.ContextDB.
+// options are Retry, RetryBackoff and RetryIf.
+func TxRetry(options ...func(*TxOptions)) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.txRetry = append(db.txRetry, options...)
+	}
+}
+
+// RetryTx runs fn, and re-runs it by the policy of TxRetry while it fails with a retryable error, after a backoff.
+// Every retry is written to the SQL log. fn gets the attempt (from 1), and must run the whole transaction again in a new session.
+func (db *ContextDB) RetryTx(ctx context.Context, fn func(attempt int) error) error {
+	return newTxOptions(db.txRetry...).retry(ctx, db.Engine.Logger(), fn)
+}
+
+// retry runs fn until it succeeds, fails with an error which isn't retryable, or is retried MaxRetries times.
+func (o TxOptions) retry(ctx context.Context, logger interface{}, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || attempt > o.MaxRetries || !o.Retryable(err) {
+			return err
+		}
+		backoff := o.backoff(attempt)
+		logRetry(ctx, logger, attempt, o.MaxRetries, backoff, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the time to wait before the retry-th retry (from 1): a random duration between the half and the whole
+// of the exponential backoff, so that the retries of conflicting transactions are spread.
+func (o TxOptions) backoff(retry int) time.Duration {
+	d := o.MinBackoff
+	for i := 1; i < retry && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// logRetry writes the retry to the SQL log of the engine, if it's set by New.
+func logRetry(ctx context.Context, logger interface{}, retry, maxRetries int, backoff time.Duration, err error) {
+	l, ok := logger.(*dbLogger)
+	if !ok {
+		return
+	}
+	log := &SqlLog{
+		Service:   l.serviceName,
+		Retry:     retry,
+		Level:     "warn",
+		Error:     err.Error(),
+		Message:   fmt.Sprintf("retry transaction (%d/%d) in %v", retry, maxRetries, backoff),
+		Timestamp: time.Now(),
+	}
+	log.RequestID, log.ActionID = ids(ctx)
+	l.write(log)
+}
+
+// logIgnoredRetry warns that the Retry option is ignored, since WithTx joins an outer transaction.
+func logIgnoredRetry(ctx context.Context, logger interface{}, maxRetries int) {
+	message := fmt.Sprintf("retry (%d) is ignored: the transaction joins an outer transaction, e.g. of echomiddleware.ContextDB (see TxRetry)", maxRetries)
+	l, ok := logger.(*dbLogger)
+	if !ok || l.sink == nil {
+		log.Println("ctxdb:", message)
+		return
+	}
+	log := &SqlLog{
+		Service:   l.serviceName,
+		Level:     "warn",
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+	log.RequestID, log.ActionID = ids(ctx)
+	l.write(log)
+}
@@ -0,0 +1,125 @@
+package ctxdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+// mysqlError is like the error of go-sql-driver/mysql.
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+// pqError is like the error of lib/pq.
+type pqError struct {
+	Code pqErrorCode
+}
+
+type pqErrorCode string
+
+func (e pqError) Error() string { return "pq: " + string(e.Code) }
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "ERROR: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+var errDeadlock = &mysqlError{1213, "Deadlock found when trying to get lock; try restarting transaction"}
+
+func TestIsRetryable(t *testing.T) {
+	test.Assert(t, ctxdb.IsRetryable(errDeadlock), "deadlock should be retryable")
+	test.Assert(t, ctxdb.IsRetryable(&mysqlError{1205, "Lock wait timeout exceeded"}), "lock wait timeout should be retryable")
+	test.Assert(t, ctxdb.IsRetryable(fmt.Errorf("create order: %w", errDeadlock)), "wrapped deadlock should be retryable")
+	test.Assert(t, ctxdb.IsRetryable(pqError{"40001"}), "serialization failure should be retryable")
+	test.Assert(t, ctxdb.IsRetryable(sqlStateError("40P01")), "deadlock should be retryable")
+
+	test.Assert(t, !ctxdb.IsRetryable(&mysqlError{1062, "Duplicate entry"}), "duplicate entry should not be retryable")
+	test.Assert(t, !ctxdb.IsRetryable(pqError{"23505"}), "unique violation should not be retryable")
+	test.Assert(t, !ctxdb.IsRetryable(errors.New("Error 1213")), "errors are not recognized by messages")
+	test.Assert(t, !ctxdb.IsRetryable(nil), "nil should not be retryable")
+}
+
+func TestWithTxRetry(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	sink := ctxdb.NewMemorySink()
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.WithSqlLogSink(sink))
+	session := db.NewSession(context.Background())
+	defer session.Close()
+	ctx := ctxdb.ToCtx(context.Background(), session)
+
+	failing := func(n int, err error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			if n > 0 {
+				n--
+				return err
+			}
+			return nil
+		}
+	}
+	backoff := ctxdb.RetryBackoff(time.Millisecond, 2*time.Millisecond)
+
+	t.Run("retried", func(t *testing.T) {
+		fake.Reset()
+		sink.Reset()
+		test.Ok(t, ctxdb.WithTx(ctx, failing(2, errDeadlock), ctxdb.Retry(3), backoff))
+		test.Equals(t, "BEGIN; ROLLBACK; BEGIN; ROLLBACK; BEGIN; COMMIT", statements(fake.Log()))
+
+		var retries []int
+		for _, log := range sink.Logs() {
+			if log.Retry != 0 {
+				test.Equals(t, errDeadlock.Error(), log.Error)
+				retries = append(retries, log.Retry)
+			}
+		}
+		test.Equals(t, []int{1, 2}, retries)
+	})
+
+	t.Run("too many retries", func(t *testing.T) {
+		fake.Reset()
+		err := ctxdb.WithTx(ctx, failing(3, errDeadlock), ctxdb.Retry(2), backoff)
+		test.Equals(t, errDeadlock, err)
+		test.Equals(t, "BEGIN; ROLLBACK; BEGIN; ROLLBACK; BEGIN; ROLLBACK", statements(fake.Log()))
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		fake.Reset()
+		err := ctxdb.WithTx(ctx, failing(1, errors.New("failed")), ctxdb.Retry(2), backoff)
+		test.Equals(t, "failed", err.Error())
+		test.Equals(t, "BEGIN; ROLLBACK", statements(fake.Log()))
+	})
+
+	t.Run("joined", func(t *testing.T) {
+		fake.Reset()
+		sink.Reset()
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			return ctxdb.WithTx(ctx, failing(1, errDeadlock), ctxdb.Retry(2), backoff)
+		})
+		test.Equals(t, errDeadlock, err)
+		test.Equals(t, "BEGIN; ROLLBACK", statements(fake.Log()))
+
+		// e.g. in a transaction of echomiddleware.ContextDB
+		warned := false
+		for _, log := range sink.Logs() {
+			warned = warned || log.Level == "warn" && strings.HasPrefix(log.Message, "retry (2) is ignored")
+		}
+		test.Assert(t, warned, "ignored retry should be warned")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := ctxdb.WithTx(ctx, failing(1, errDeadlock), ctxdb.Retry(2), backoff)
+		test.Equals(t, context.Canceled, err)
+	})
+}
@@ -0,0 +1,203 @@
+package ctxdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/pangpanglabs/goutils/kafka"
+)
+
+// SqlLogSink is where SQL logs are written to. Sinks which need to be closed implement io.Closer.
+type SqlLogSink interface {
+	Write(log *SqlLog) error
+}
+
+type SqlLogSinkFunc func(log *SqlLog) error
+
+func (f SqlLogSinkFunc) Write(log *SqlLog) error {
+	return f(log)
+}
+
+// WithSqlLogSink adds a sink of SQL logs, in addition to Kafka if kafka.Config has brokers.
+func WithSqlLogSink(sinks ...SqlLogSink) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.sinks = append(db.sinks, sinks...)
+	}
+}
+
+// KafkaSink sends SQL logs to the topic of producer.
+func KafkaSink(producer *kafka.Producer) SqlLogSink {
+	return SqlLogSinkFunc(func(log *SqlLog) error {
+		return producer.Send(log)
+	})
+}
+
+// JSONSink writes SQL logs to w as JSON lines, e.g. JSONSink(os.Stdout) for local development.
+func JSONSink(w io.Writer) SqlLogSink {
+	var mu sync.Mutex
+	return SqlLogSinkFunc(func(log *SqlLog) error {
+		b, err := json.Marshal(log)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// StdoutSink is JSONSink(os.Stdout).
+func StdoutSink() SqlLogSink {
+	return JSONSink(os.Stdout)
+}
+
+// FanOut writes SQL logs to all sinks, and returns the first error.
+func FanOut(sinks ...SqlLogSink) SqlLogSink {
+	return SqlLogSinkFunc(func(log *SqlLog) error {
+		var firstErr error
+		for _, sink := range sinks {
+			if err := sink.Write(log); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	})
+}
+
+// Sample writes a rate (0 to 1) of SQL logs to sink. Errors and slow queries are always written.
+func Sample(sink SqlLogSink, rate float64) SqlLogSink {
+	return SqlLogSinkFunc(func(log *SqlLog) error {
+		if log.Error == "" && !log.Slow && rand.Float64() >= rate {
+			return nil
+		}
+		return sink.Write(log)
+	})
+}
+
+// MemorySink keeps SQL logs in memory, e.g. for tests.
+type MemorySink struct {
+	mu   sync.Mutex
+	logs []SqlLog
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Write(log *SqlLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, *log)
+	return nil
+}
+
+// Logs returns a copy of the written logs.
+func (s *MemorySink) Logs() []SqlLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SqlLog(nil), s.logs...)
+}
+
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = nil
+}
+
+// FileSink writes SQL logs to a file as JSON lines.
+// When the file exceeds MaxSize bytes, it's renamed to path.1 (path.1 to path.2, and so on) and a new file is created.
+// Only MaxBackups old files are kept.
+type FileSink struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Write(log *SqlLog) error {
+	b, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if s.MaxSize > 0 && s.size > 0 && s.size+int64(len(b)) > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", s.Path, i) }
+	if s.MaxBackups > 0 {
+		os.Remove(backup(s.MaxBackups))
+		for i := s.MaxBackups - 1; i >= 1; i-- {
+			if _, err := os.Stat(backup(i)); err == nil {
+				if err := os.Rename(backup(i), backup(i+1)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := os.Rename(s.Path, backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.Path); err != nil {
+		return err
+	}
+	return s.open()
+}
@@ -0,0 +1,98 @@
+package ctxdb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestSqlLogSink(t *testing.T) {
+	engine, _ := newFakeEngine(t)
+	sink := ctxdb.NewMemorySink()
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.WithSqlLogSink(sink))
+
+	cb := ctxbase.New("req-1", "", "")
+	session := db.NewSession(cb.ToCtx(context.Background()))
+	defer session.Close()
+	_, err := session.Exec("UPDATE t SET a = ?", 1)
+	test.Ok(t, err)
+
+	logs := sink.Logs()
+	test.Equals(t, 1, len(logs))
+	test.Equals(t, "test", logs[0].Service)
+	test.Equals(t, "req-1", logs[0].RequestID)
+	test.Equals(t, cb.ActionID, logs[0].ActionID)
+	test.Equals(t, "UPDATE t SET a = ?", logs[0].Sql)
+	test.Equals(t, []interface{}{1}, logs[0].Args)
+	test.Equals(t, int64(1), logs[0].RowsAffected)
+}
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := ctxdb.JSONSink(&buf)
+	test.Ok(t, sink.Write(&ctxdb.SqlLog{Service: "test", Sql: "SELECT 1"}))
+	test.Ok(t, sink.Write(&ctxdb.SqlLog{Service: "test", Sql: "SELECT 2"}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	test.Equals(t, 2, len(lines))
+	var log ctxdb.SqlLog
+	test.Ok(t, json.Unmarshal([]byte(lines[1]), &log))
+	test.Equals(t, "SELECT 2", log.Sql)
+}
+
+func TestFanOutAndSample(t *testing.T) {
+	sink1, sink2 := ctxdb.NewMemorySink(), ctxdb.NewMemorySink()
+	errFailed := errors.New("failed")
+	failing := ctxdb.SqlLogSinkFunc(func(*ctxdb.SqlLog) error { return errFailed })
+
+	sink := ctxdb.FanOut(sink1, failing, ctxdb.Sample(sink2, 0))
+	test.Equals(t, errFailed, sink.Write(&ctxdb.SqlLog{Sql: "SELECT 1"}))
+	test.Equals(t, errFailed, sink.Write(&ctxdb.SqlLog{Sql: "SELECT 2", Slow: true}))
+	test.Equals(t, errFailed, sink.Write(&ctxdb.SqlLog{Sql: "SELECT 3", Error: "timeout"}))
+
+	test.Equals(t, 3, len(sink1.Logs()))
+	// errors and slow queries are always sampled
+	test.Equals(t, 2, len(sink2.Logs()))
+
+	all := ctxdb.NewMemorySink()
+	test.Ok(t, ctxdb.Sample(all, 1).Write(&ctxdb.SqlLog{Sql: "SELECT 1"}))
+	test.Equals(t, 1, len(all.Logs()))
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctxdb")
+	test.Ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sql.log")
+
+	line, _ := json.Marshal(&ctxdb.SqlLog{Sql: "SELECT 1"})
+	// two logs fit into a file
+	sink, err := ctxdb.NewFileSink(path, int64(len(line)+1)*2, 2)
+	test.Ok(t, err)
+	for i := 0; i < 7; i++ {
+		test.Ok(t, sink.Write(&ctxdb.SqlLog{Sql: "SELECT 1"}))
+	}
+	test.Ok(t, sink.Close())
+
+	count := func(path string) int {
+		b, err := ioutil.ReadFile(path)
+		test.Ok(t, err)
+		return strings.Count(string(b), "\n")
+	}
+	test.Equals(t, 1, count(path))
+	test.Equals(t, 2, count(path+".1"))
+	test.Equals(t, 2, count(path+".2"))
+	_, err = os.Stat(path + ".3")
+	test.Assert(t, os.IsNotExist(err), "only 2 backups should be kept")
+}
@@ -0,0 +1,574 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pangpanglabs/goutils/behaviorlog"
+	"xorm.io/xorm/contexts"
+)
+
+const DefaultTenantColumn = "tenant_code"
+
+var (
+	ErrNoTenant        = errors.New("ctxdb: no tenant in the context")
+	ErrTenantNotScoped = errors.New("ctxdb: sql is not scoped by the tenant")
+	ErrTenantMismatch  = errors.New("ctxdb: tenant of sql doesn't match the context")
+)
+
+// TenantTables marks tables tenant-scoped. SQL of these tables fails with ErrNoTenant if there's no tenant in the context.
+// "<table>.<tenant column> = ?" with the tenant of the context is added to the WHERE clause of every statement and subquery
+// reading or writing them, and the tenant column of inserted rows is set to the tenant if it's empty.
+// Inserts without the tenant column in the column list fail with ErrTenantNotScoped.
+func TenantTables(tables ...string) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.tenantTables = append(db.tenantTables, tables...)
+	}
+}
+
+// TenantColumn sets the tenant column of tenant-scoped tables. The default is DefaultTenantColumn.
+func TenantColumn(column string) func(*ContextDB) {
+	return func(db *ContextDB) {
+		db.tenantColumn = column
+	}
+}
+
+type tenantKey struct{}
+
+type noTenantKey struct{}
+
+// WithTenant sets the tenant of ctx.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromCtx returns the tenant set by WithTenant, or the TenantCode of behaviorlog.LogContext (from the JWT).
+func TenantFromCtx(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	if c := behaviorlog.FromCtx(ctx); c != nil {
+		return c.TenantCode
+	}
+	return ""
+}
+
+// WithoutTenant disables tenant scoping for ctx, e.g. for jobs across tenants.
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTenantKey{}, true)
+}
+
+// tenantHook checks the SQL of tenant-scoped tables before it's executed. The tenant condition is added by the connections
+// of the engine (see tenantConnector); the hook fails SQL without a tenant, and SQL setting or comparing another tenant.
+type tenantHook struct {
+	*tenantScope
+	// scoped is false if the connections of the engine couldn't be wrapped, then only inserts are allowed
+	scoped bool
+}
+
+var _ contexts.Hook = &tenantHook{}
+
+func (h *tenantHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	if err := h.check(c.Ctx, c.SQL, c.Args); err != nil {
+		return c.Ctx, err
+	}
+	return c.Ctx, nil
+}
+
+func (h *tenantHook) AfterProcess(c *contexts.ContextHook) error {
+	return nil
+}
+
+var sqlTablesPattern = regexp.MustCompile("(?i)\\b(?:FROM|JOIN|INTO|UPDATE)\\s+([`\"\\w.]+)")
+
+// check returns an error if sql of a tenant-scoped table has no tenant in ctx, or binds a tenant other than the tenant of ctx.
+// Empty tenants of inserted rows are set in args, which are the args passed to the driver.
+func (h *tenantHook) check(ctx context.Context, sql string, args []interface{}) error {
+	var table string
+	for _, m := range sqlTablesPattern.FindAllStringSubmatch(sql, -1) {
+		if t := unquoteIdentifier(m[1]); h.tables[t] {
+			table = t
+			break
+		}
+	}
+	if table == "" {
+		return nil
+	}
+	if ctx != nil && ctx.Value(noTenantKey{}) != nil {
+		return nil
+	}
+	tenant := TenantFromCtx(ctx)
+	if tenant == "" {
+		return fmt.Errorf("%w: %s", ErrNoTenant, table)
+	}
+
+	target, columns := parseSQLArgs(sql)
+	m := sqlInsertPattern.FindStringSubmatch(sql)
+	insert := m != nil
+	if insert && h.tables[target] && !containsColumn(m[1], h.column) {
+		// the tenant of rows inserted without the tenant column can't be set
+		return fmt.Errorf("%w: %s", ErrTenantNotScoped, target)
+	}
+	for i, column := range columns {
+		if column != h.column || i >= len(args) {
+			continue
+		}
+		if insert && (args[i] == nil || args[i] == "") {
+			args[i] = tenant
+		}
+		if fmt.Sprint(args[i]) != tenant {
+			return fmt.Errorf("%w: %s", ErrTenantMismatch, table)
+		}
+	}
+	if !insert && !h.scoped {
+		return fmt.Errorf("%w: %s", ErrTenantNotScoped, table)
+	}
+	return nil
+}
+
+// containsColumn reports whether column is in the column list of INSERT.
+func containsColumn(list, column string) bool {
+	for _, name := range strings.Split(list, ",") {
+		if unquoteIdentifier(name) == column {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantScope adds the tenant condition to SQL of tenant-scoped tables.
+type tenantScope struct {
+	column string
+	tables map[string]bool
+}
+
+func newTenantScope(column string, tables []string) *tenantScope {
+	if column == "" {
+		column = DefaultTenantColumn
+	}
+	s := &tenantScope{column: strings.ToLower(column), tables: map[string]bool{}}
+	for _, table := range tables {
+		s.tables[unquoteIdentifier(table)] = true
+	}
+	return s
+}
+
+// tenant returns the tenant of ctx, or false if SQL of ctx isn't scoped.
+func (s *tenantScope) tenant(ctx context.Context) (string, bool) {
+	if s == nil || ctx == nil || ctx.Value(noTenantKey{}) != nil {
+		return "", false
+	}
+	tenant := TenantFromCtx(ctx)
+	return tenant, tenant != ""
+}
+
+// scope returns sql with "<table>.<tenant column> = ?" added to the WHERE clause of every query block (statement or subquery)
+// for each tenant-scoped table it reads or writes, or to the ON clause of a table joined by LEFT JOIN, so that rows of
+// the other tables are kept. at are the indexes of the args before which the tenant is bound, in order, or -1 if it's
+// bound after the args, for placeholders like $1. numInput is the number of args, or -1 if it's unknown.
+// It fails with ErrTenantNotScoped if a tenant-scoped table can't be scoped, instead of running the SQL unscoped.
+func (s *tenantScope) scope(sql string, dollar bool, numInput int) (string, []int, error) {
+	p := &scopeParser{tenantScope: s, sql: sql, dollar: dollar}
+	table := ""
+	var placeholders []int
+	for _, m := range sqlScopeTokenPattern.FindAllStringIndex(sql, -1) {
+		t := sqlToken{text: sql[m[0]:m[1]], start: m[0], end: m[1]}
+		switch {
+		case strings.HasPrefix(t.text, "--") || strings.HasPrefix(t.text, "/*"):
+			continue
+		case t.text == "?":
+			placeholders = append(placeholders, t.start)
+		case t.text[0] == '$' && len(t.text) > 1:
+			if n, _ := strconv.Atoi(t.text[1:]); n > p.placeholder {
+				p.placeholder = n
+			}
+		case table == "" && isIdentifier(t.text) && s.tables[unquoteIdentifier(t.text)]:
+			table = unquoteIdentifier(t.text)
+		}
+		p.tokens = append(p.tokens, t)
+	}
+	if table == "" {
+		return sql, nil, nil
+	}
+	// references of tenant-scoped tables which must be scoped, i.e. not the table of INSERT INTO
+	refs := 0
+	for _, m := range sqlTablesPattern.FindAllStringSubmatch(sql, -1) {
+		if s.tables[unquoteIdentifier(m[1])] && !strings.EqualFold(m[0][:4], "INTO") {
+			refs++
+		}
+	}
+
+	for p.i < len(p.tokens) {
+		p.block()
+		// ";", or an unbalanced ")"
+		p.next()
+	}
+	if p.refs < refs || !dollar && numInput >= 0 && numInput != len(placeholders) {
+		return "", nil, fmt.Errorf("%w: %s", ErrTenantNotScoped, table)
+	}
+
+	// the edits are made in the order of their positions, and the tenants are bound in that order
+	sort.SliceStable(p.edits, func(i, j int) bool { return p.edits[i].pos < p.edits[j].pos })
+	var b strings.Builder
+	var at []int
+	pos := 0
+	for _, e := range p.edits {
+		b.WriteString(sql[pos:e.pos])
+		b.WriteString(e.text)
+		pos = e.pos
+		i := -1
+		if !dollar {
+			i = sort.SearchInts(placeholders, e.pos)
+		}
+		for n := 0; n < e.tenants; n++ {
+			at = append(at, i)
+		}
+	}
+	b.WriteString(sql[pos:])
+	return b.String(), at, nil
+}
+
+// withTenant returns args with the tenant bound at the indexes returned by tenantScope.scope.
+func withTenant(args []driver.NamedValue, at []int, tenant string) []driver.NamedValue {
+	if len(at) == 0 {
+		return args
+	}
+	scoped := make([]driver.NamedValue, 0, len(args)+len(at))
+	for i := 0; i <= len(args); i++ {
+		for len(at) != 0 && (at[0] == i || at[0] < 0 && i == len(args)) {
+			scoped = append(scoped, driver.NamedValue{Value: tenant})
+			at = at[1:]
+		}
+		if i < len(args) {
+			scoped = append(scoped, args[i])
+		}
+	}
+	for i := range scoped {
+		scoped[i].Ordinal = i + 1
+	}
+	return scoped
+}
+
+var sqlScopeTokenPattern = regexp.MustCompile("`[^`]*`|\"[^\"]*\"|'(?:[^'\\\\]|\\\\.|'')*'|--[^\\n]*|/\\*(?s:.*?)\\*/|\\$\\d+|[\\w.]+|\\?|\\S")
+
+var (
+	// sqlClauseEnds end the WHERE clause of a query block
+	sqlClauseEnds = map[string]bool{}
+	// sqlJoins start a joined table
+	sqlJoins = map[string]bool{}
+	// sqlNotAliases are words after a table which are not its alias
+	sqlNotAliases = map[string]bool{}
+)
+
+func init() {
+	for _, k := range strings.Fields("GROUP HAVING ORDER LIMIT OFFSET FETCH FOR LOCK WINDOW RETURNING UNION EXCEPT INTERSECT") {
+		sqlClauseEnds[k] = true
+		sqlNotAliases[k] = true
+	}
+	for _, k := range strings.Fields("JOIN INNER LEFT RIGHT FULL OUTER CROSS NATURAL STRAIGHT_JOIN") {
+		sqlJoins[k] = true
+		sqlNotAliases[k] = true
+	}
+	for _, k := range strings.Fields("AS ON USING WHERE SET USE FORCE IGNORE PARTITION TABLESAMPLE") {
+		sqlNotAliases[k] = true
+	}
+}
+
+type sqlToken struct {
+	text       string
+	start, end int
+}
+
+// sqlEdit inserts text at pos of the SQL.
+type sqlEdit struct {
+	pos  int
+	text string
+	// tenants is the number of placeholders of the tenant in text
+	tenants int
+}
+
+// scopeParser adds the tenant conditions to the query blocks of SQL.
+type scopeParser struct {
+	*tenantScope
+	sql    string
+	tokens []sqlToken
+	i      int
+	// last is the end of the last token read
+	last  int
+	edits []sqlEdit
+	// dollar is true for placeholders like $1, and placeholder is the last one
+	dollar      bool
+	placeholder int
+	// refs is the number of references of tenant-scoped tables found
+	refs int
+}
+
+// peek returns the token n tokens after the current token in upper case, or "" after the last token.
+func (p *scopeParser) peek(n int) string {
+	if p.i+n < len(p.tokens) {
+		return strings.ToUpper(p.tokens[p.i+n].text)
+	}
+	return ""
+}
+
+func (p *scopeParser) next() {
+	if p.i < len(p.tokens) {
+		p.last = p.tokens[p.i].end
+		p.i++
+	}
+}
+
+// start returns the position of the current token.
+func (p *scopeParser) start() int {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i].start
+	}
+	return len(p.sql)
+}
+
+func (p *scopeParser) conditions(qualifiers []string) string {
+	var conditions []string
+	for _, qualifier := range qualifiers {
+		placeholder := "?"
+		if p.dollar {
+			p.placeholder++
+			placeholder = "$" + strconv.Itoa(p.placeholder)
+		}
+		conditions = append(conditions, qualifier+"."+p.column+" = "+placeholder)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// table reads the table reference at the current token. It returns the alias of the table or its name as written,
+// and whether the table is tenant-scoped.
+func (p *scopeParser) table() (string, bool) {
+	if p.i >= len(p.tokens) || !isIdentifier(p.tokens[p.i].text) {
+		return "", false
+	}
+	start := p.tokens[p.i].start
+	p.next()
+	for p.peek(0) == "." && p.i+1 < len(p.tokens) && isIdentifier(p.tokens[p.i+1].text) {
+		p.next()
+		p.next()
+	}
+	name := p.sql[start:p.last]
+	qualifier := name
+	if p.peek(0) == "AS" {
+		p.next()
+	}
+	if p.i < len(p.tokens) && isIdentifier(p.tokens[p.i].text) && !sqlNotAliases[p.peek(0)] {
+		qualifier = p.tokens[p.i].text
+		p.next()
+	}
+	if !p.tables[unquoteIdentifier(name)] {
+		return "", false
+	}
+	p.refs++
+	return qualifier, true
+}
+
+// block adds the tenant conditions to the query block at the current token, which ends before ")" or ";",
+// and to the blocks nested in it or following it by UNION.
+func (p *scopeParser) block() {
+	const (
+		start = iota
+		insert
+		tables
+		on
+		where
+		other // SELECT list, SET, and WHERE of statements without tables
+		done  // clauses after WHERE
+	)
+	state := start
+	depth := 0
+	// scoped are the tenant-scoped tables scoped in the WHERE clause, and joined is the table scoped in the current ON clause
+	var scoped []string
+	joined := ""
+	// left is true in LEFT JOIN, and pending is true if the last table of scoped is joined by it, before its ON clause
+	left, pending := false, false
+	whereAt, onAt := -1, -1
+
+	table := func() {
+		if qualifier, ok := p.table(); ok {
+			scoped = append(scoped, qualifier)
+			pending = left
+		}
+		left = false
+	}
+	closeOn := func() {
+		pending = false
+		if joined != "" {
+			p.edits = append(p.edits, sqlEdit{pos: onAt, text: "("},
+				sqlEdit{pos: p.last, text: ") AND " + p.conditions([]string{joined}), tenants: 1})
+		}
+		joined = ""
+	}
+	closeWhere := func() {
+		closeOn()
+		if len(scoped) != 0 {
+			if whereAt >= 0 {
+				p.edits = append(p.edits, sqlEdit{pos: whereAt, text: "("},
+					sqlEdit{pos: p.last, text: ") AND " + p.conditions(scoped), tenants: len(scoped)})
+			} else {
+				p.edits = append(p.edits, sqlEdit{pos: p.last, text: " WHERE " + p.conditions(scoped), tenants: len(scoped)})
+			}
+		}
+		scoped = nil
+		state = done
+	}
+
+	switch p.peek(0) {
+	case "INSERT", "REPLACE":
+		state = insert
+	case "UPDATE":
+		state = tables
+		p.next()
+		table()
+	}
+	for p.i < len(p.tokens) {
+		text, word := p.tokens[p.i].text, p.peek(0)
+		if text == "(" {
+			p.next()
+			if p.peek(0) != "SELECT" && p.peek(0) != "WITH" {
+				depth++
+				continue
+			}
+			p.block()
+			if p.peek(0) == ")" {
+				p.next()
+			}
+			if depth == 0 && state == tables {
+				// alias of a derived table
+				if p.peek(0) == "AS" {
+					p.next()
+				}
+				if p.i < len(p.tokens) && isIdentifier(p.tokens[p.i].text) && !sqlNotAliases[p.peek(0)] {
+					p.next()
+				}
+			}
+			continue
+		}
+		if text == ";" || text == ")" && depth == 0 {
+			break
+		}
+		if text == ")" {
+			depth--
+		}
+		if depth > 0 || text == ")" {
+			p.next()
+			continue
+		}
+
+		end := sqlClauseEnds[word] || word == "ON" && p.peek(1) == "DUPLICATE"
+		join := sqlJoins[word] && p.peek(1) != "("
+		switch state {
+		case insert:
+			if word == "SELECT" || word == "WITH" {
+				p.block()
+				continue
+			}
+		case start, other:
+			switch {
+			case word == "FROM":
+				state = tables
+				p.next()
+				table()
+				continue
+			case word == "WHERE":
+				state = where
+				p.next()
+				whereAt = p.start()
+				continue
+			case end:
+				closeWhere()
+				continue
+			}
+		case tables, on:
+			switch {
+			case text == "," || join:
+				closeOn()
+				state = tables
+				if word == "LEFT" {
+					left = true
+				} else if word != "OUTER" && word != "JOIN" {
+					left = false
+				}
+				p.next()
+				if text == "," || word == "JOIN" || word == "STRAIGHT_JOIN" {
+					table()
+				}
+				continue
+			case word == "ON" && state == tables && !end:
+				// tables joined by LEFT JOIN are scoped in the ON clause, so that the rows of the other tables are kept
+				if pending {
+					joined = scoped[len(scoped)-1]
+					scoped = scoped[:len(scoped)-1]
+				}
+				pending = false
+				state = on
+				p.next()
+				onAt = p.start()
+				continue
+			case word == "WHERE":
+				closeOn()
+				state = where
+				p.next()
+				whereAt = p.start()
+				continue
+			case word == "SET":
+				closeOn()
+				state = other
+			case end:
+				closeWhere()
+				continue
+			}
+		case where:
+			if end {
+				closeWhere()
+				continue
+			}
+		case done:
+			if word == "UNION" || word == "EXCEPT" || word == "INTERSECT" {
+				p.next()
+				if p.peek(0) == "ALL" || p.peek(0) == "DISTINCT" {
+					p.next()
+				}
+				if p.peek(0) == "SELECT" {
+					p.block()
+					return
+				}
+				continue
+			}
+		}
+		p.next()
+	}
+	if state != done && state != insert {
+		closeWhere()
+	}
+}
+
+func isIdentifier(token string) bool {
+	return token[0] == '`' || token[0] == '"' || token[0] == '_' || isLetter(token[0])
+}
+
+// placeholdersBefore returns the number of placeholders before the first keyword in sql, or all of them if there's no keyword.
+func placeholdersBefore(sql, keyword string) int {
+	n := 0
+	for _, token := range sqlTokenPattern.FindAllString(sql, -1) {
+		if token == "?" {
+			n++
+		} else if strings.EqualFold(token, keyword) {
+			break
+		}
+	}
+	return n
+}
@@ -0,0 +1,297 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"sync"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+// tenantConnectors are the connectors of the engines opened by NewEngine.
+var tenantConnectors sync.Map // *xorm.Engine -> *tenantConnector
+
+// NewEngine opens an engine like xorm.NewEngine, but on connections which can be scoped by TenantTables,
+// so that New doesn't have to reopen them, and the settings of the connection pool are kept.
+func NewEngine(driverName, dataSourceName string) (*xorm.Engine, error) {
+	engine, err := xorm.NewEngine(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := reopenTenant(engine)
+	if err != nil {
+		engine.Close()
+		return nil, err
+	}
+	tenantConnectors.Store(engine, connector)
+	return engine, nil
+}
+
+// scopeTenant scopes the connections of engine by scope, since xorm resets the conditions of a session after every
+// statement, and hooks can't change the SQL. Engines not opened by NewEngine are reopened by a tenantConnector,
+// which keeps the limit of open connections, but resets the other settings of the connection pool.
+func scopeTenant(engine *xorm.Engine, scope *tenantScope) error {
+	if c, ok := tenantConnectors.Load(engine); ok {
+		tenantConnectors.Delete(engine)
+		c.(*tenantConnector).scope = scope
+		return nil
+	}
+	maxOpen := engine.DB().DB.Stats().MaxOpenConnections
+	connector, err := reopenTenant(engine)
+	if err != nil {
+		return err
+	}
+	connector.scope = scope
+	engine.DB().DB.SetMaxOpenConns(maxOpen)
+	return nil
+}
+
+// reopenTenant replaces the connections of engine by the connections of a tenantConnector without a scope,
+// and closes the replaced ones.
+func reopenTenant(engine *xorm.Engine) (*tenantConnector, error) {
+	db := engine.DB()
+	var connector driver.Connector = dsnConnector{dsn: engine.DataSourceName(), driver: db.DB.Driver()}
+	if d, ok := db.DB.Driver().(driver.DriverContext); ok {
+		c, err := d.OpenConnector(engine.DataSourceName())
+		if err != nil {
+			return nil, err
+		}
+		connector = c
+	}
+	tenant := &tenantConnector{
+		Connector: connector,
+		dollar:    engine.Dialect().URI().DBType == schemas.POSTGRES,
+	}
+
+	unscoped := db.DB
+	db.DB = sql.OpenDB(tenant)
+	if err := unscoped.Close(); err != nil {
+		log.Println("ctxdb: failed to close the replaced connections:", err)
+	}
+	return tenant, nil
+}
+
+// dsnConnector is the connector of drivers which don't implement driver.DriverContext.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+// tenantConnector opens connections which add the tenant condition of the context to SQL of tenant-scoped tables.
+type tenantConnector struct {
+	driver.Connector
+	// scope is nil until the engine is passed to New with TenantTables
+	scope *tenantScope
+	// dollar is true if the placeholders of the database are $1, $2, ...
+	dollar bool
+}
+
+func (c *tenantConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantConn{Conn: conn, connector: c}, nil
+}
+
+type tenantConn struct {
+	driver.Conn
+	connector *tenantConnector
+}
+
+var (
+	_ driver.QueryerContext     = &tenantConn{}
+	_ driver.ExecerContext      = &tenantConn{}
+	_ driver.ConnPrepareContext = &tenantConn{}
+	_ driver.ConnBeginTx        = &tenantConn{}
+	_ driver.NamedValueChecker  = &tenantConn{}
+	_ driver.Pinger             = &tenantConn{}
+	_ driver.SessionResetter    = &tenantConn{}
+)
+
+// scope returns query and args scoped by the tenant of ctx.
+func (c *tenantConn) scope(ctx context.Context, query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	tenant, ok := c.connector.scope.tenant(ctx)
+	if !ok {
+		return query, args, nil
+	}
+	query, at, err := c.connector.scope.scope(query, c.connector.dollar, len(args))
+	if err != nil {
+		return "", nil, err
+	}
+	return query, withTenant(args, at, tenant), nil
+}
+
+func (c *tenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		// database/sql prepares the query
+		return nil, driver.ErrSkip
+	}
+	query, args, err := c.scope(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *tenantConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query, args, err := c.scope(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *tenantConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tenantConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	tenant, scoped := c.connector.scope.tenant(ctx)
+	var at []int
+	if scoped {
+		var err error
+		if query, at, err = c.connector.scope.scope(query, c.connector.dollar, -1); err != nil {
+			return nil, err
+		}
+	}
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil || len(at) == 0 {
+		return stmt, err
+	}
+	return &tenantStmt{Stmt: stmt, conn: c, at: at, tenant: tenant}, nil
+}
+
+func (c *tenantConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("ctxdb: driver doesn't support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tenantConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *tenantConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tenantConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator.
+func (c *tenantConn) IsValid() bool {
+	if validator, ok := c.Conn.(interface{ IsValid() bool }); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// tenantStmt binds the tenant of the context to a prepared statement scoped by tenantScope.
+type tenantStmt struct {
+	driver.Stmt
+	conn *tenantConn
+	at   []int
+	// tenant is the tenant of the context the statement is prepared in
+	tenant string
+}
+
+var (
+	_ driver.StmtExecContext   = &tenantStmt{}
+	_ driver.StmtQueryContext  = &tenantStmt{}
+	_ driver.NamedValueChecker = &tenantStmt{}
+)
+
+func (s *tenantStmt) NumInput() int {
+	if n := s.Stmt.NumInput(); n >= 0 {
+		return n - len(s.at)
+	}
+	return -1
+}
+
+func (s *tenantStmt) args(ctx context.Context, args []driver.NamedValue) []driver.NamedValue {
+	tenant, ok := s.conn.connector.scope.tenant(ctx)
+	if !ok {
+		tenant = s.tenant
+	}
+	return withTenant(args, s.at, tenant)
+}
+
+func (s *tenantStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	args = s.args(ctx, args)
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+	return s.Stmt.Exec(values(args))
+}
+
+func (s *tenantStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	args = s.args(ctx, args)
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, args)
+	}
+	return s.Stmt.Query(values(args))
+}
+
+func (s *tenantStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *tenantStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *tenantStmt) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return s.conn.CheckNamedValue(v)
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
@@ -0,0 +1,55 @@
+package ctxdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestTenantScope(t *testing.T) {
+	s := newTenantScope("", []string{"order", "order_item"})
+	for _, c := range []struct {
+		sql, scoped string
+		at          []int
+	}{
+		{"SELECT * FROM store WHERE id = ?", "SELECT * FROM store WHERE id = ?", nil},
+		{"INSERT INTO `order` (`id`,`tenant_code`) VALUES (?,?)", "INSERT INTO `order` (`id`,`tenant_code`) VALUES (?,?)", nil},
+		{"SELECT count(*) FROM `order`",
+			"SELECT count(*) FROM `order` WHERE `order`.tenant_code = ?", []int{0}},
+		{"SELECT `id` FROM `order` WHERE `id`=? LIMIT 1",
+			"SELECT `id` FROM `order` WHERE (`id`=?) AND `order`.tenant_code = ? LIMIT 1", []int{1}},
+		{"SELECT * FROM `order` WHERE id = ? OR tenant_code = ? FOR UPDATE",
+			"SELECT * FROM `order` WHERE (id = ? OR tenant_code = ?) AND `order`.tenant_code = ? FOR UPDATE", []int{2}},
+		{"UPDATE `order` SET `name` = ? WHERE `id`=?",
+			"UPDATE `order` SET `name` = ? WHERE (`id`=?) AND `order`.tenant_code = ?", []int{2}},
+		{"DELETE FROM `order`", "DELETE FROM `order` WHERE `order`.tenant_code = ?", []int{0}},
+		{"SELECT * FROM store WHERE id IN (SELECT store_id FROM `order` WHERE tenant_code = ?) AND name = ?",
+			"SELECT * FROM store WHERE id IN (SELECT store_id FROM `order` WHERE (tenant_code = ?) AND `order`.tenant_code = ?) AND name = ?", []int{1}},
+		{"SELECT * FROM `order` o JOIN order_item AS i ON i.order_id = o.id WHERE o.id = ? ORDER BY i.id",
+			"SELECT * FROM `order` o JOIN order_item AS i ON i.order_id = o.id WHERE (o.id = ?) AND o.tenant_code = ? AND i.tenant_code = ? ORDER BY i.id", []int{1, 1}},
+		{"SELECT * FROM `order` o LEFT JOIN order_item i ON i.order_id = o.id AND i.sku = ? WHERE o.id = ?",
+			"SELECT * FROM `order` o LEFT JOIN order_item i ON (i.order_id = o.id AND i.sku = ?) AND i.tenant_code = ? WHERE (o.id = ?) AND o.tenant_code = ?", []int{1, 2}},
+		{"SELECT * FROM store s, `order` o WHERE o.store_id = s.id",
+			"SELECT * FROM store s, `order` o WHERE (o.store_id = s.id) AND o.tenant_code = ?", []int{0}},
+		{"SELECT id FROM `order` UNION ALL SELECT order_id FROM order_item GROUP BY order_id",
+			"SELECT id FROM `order` WHERE `order`.tenant_code = ? UNION ALL SELECT order_id FROM order_item WHERE order_item.tenant_code = ? GROUP BY order_id", []int{0, 0}},
+		{"SELECT * FROM (SELECT * FROM `order`) t WHERE t.id = ?",
+			"SELECT * FROM (SELECT * FROM `order` WHERE `order`.tenant_code = ?) t WHERE t.id = ?", []int{0}},
+		{"INSERT INTO archive (id) SELECT id FROM `order` WHERE created < ?",
+			"INSERT INTO archive (id) SELECT id FROM `order` WHERE (created < ?) AND `order`.tenant_code = ?", []int{1}},
+	} {
+		scoped, at, err := s.scope(c.sql, false, -1)
+		test.Ok(t, err)
+		test.Equals(t, c.scoped, scoped)
+		test.Equals(t, c.at, at)
+	}
+
+	scoped, at, err := s.scope("SELECT * FROM \"order\" WHERE id = $1", true, 1)
+	test.Ok(t, err)
+	test.Equals(t, "SELECT * FROM \"order\" WHERE (id = $1) AND \"order\".tenant_code = $2", scoped)
+	test.Equals(t, []int{-1}, at)
+
+	_, _, err = s.scope("SELECT * FROM `order` WHERE id = ?", false, 2)
+	test.Assert(t, errors.Is(err, ErrTenantNotScoped), "unexpected error: %v", err)
+}
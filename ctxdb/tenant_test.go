@@ -0,0 +1,128 @@
+package ctxdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/behaviorlog"
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type tenantOrder struct {
+	ID         string `xorm:"'id' pk"`
+	TenantCode string
+	Name       string
+}
+
+func (tenantOrder) TableName() string { return "order" }
+
+func TestTenantTables(t *testing.T) {
+	engine, fake := newFakeEngine(t)
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.TenantTables("order"))
+
+	ctx := ctxdb.WithTenant(context.Background(), "pangpang")
+	session := db.NewSession(ctx)
+	defer session.Close()
+
+	t.Run("insert", func(t *testing.T) {
+		fake.Reset()
+		_, err := session.Insert(&tenantOrder{ID: "1", Name: "a"})
+		test.Ok(t, err)
+		test.Equals(t, [][]interface{}{{"1", "pangpang", "a"}}, fake.Args())
+
+		_, err = session.Insert(&tenantOrder{ID: "2", TenantCode: "other"})
+		test.Assert(t, errors.Is(err, ctxdb.ErrTenantMismatch), "unexpected error: %v", err)
+
+		_, err = session.Exec("INSERT INTO `order` (id, name) VALUES (?, ?)", "3", "c")
+		test.Assert(t, errors.Is(err, ctxdb.ErrTenantNotScoped), "unexpected error: %v", err)
+		_, err = session.Exec("INSERT INTO store (id, name) VALUES (?, ?)", "3", "c")
+		test.Ok(t, err)
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		fake.Reset()
+		var orders []tenantOrder
+		test.Ok(t, session.Find(&orders))
+		_, err := session.Where("id = ?", "1").Update(&tenantOrder{Name: "b"})
+		test.Ok(t, err)
+		_, err = session.Exec("DELETE FROM `order` WHERE id = ? OR tenant_code = ?", "1", "pangpang")
+		test.Ok(t, err)
+		_, err = session.Exec("UPDATE store SET name = ? WHERE id IN (SELECT store_id FROM `order` WHERE tenant_code = ?)", "a", "pangpang")
+		test.Ok(t, err)
+		test.Equals(t, "SELECT `id`, `tenant_code`, `name` FROM `order` WHERE `order`.tenant_code = ?; "+
+			"UPDATE `order` SET `name` = ? WHERE ((id = ?)) AND `order`.tenant_code = ?; "+
+			"DELETE FROM `order` WHERE (id = ? OR tenant_code = ?) AND `order`.tenant_code = ?; "+
+			"UPDATE store SET name = ? WHERE id IN (SELECT store_id FROM `order` WHERE (tenant_code = ?) AND `order`.tenant_code = ?)",
+			statements(fake.Log()))
+		test.Equals(t, [][]interface{}{
+			{"pangpang"},
+			{"b", "1", "pangpang"},
+			{"1", "pangpang", "pangpang"},
+			{"a", "pangpang", "pangpang"},
+		}, fake.Args())
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		var orders []tenantOrder
+		err := session.Where("tenant_code = ?", "other").Find(&orders)
+		test.Assert(t, errors.Is(err, ctxdb.ErrTenantMismatch), "unexpected error: %v", err)
+
+		_, err = session.Exec("UPDATE `order` SET tenant_code = ? WHERE id = ?", "other", "1")
+		test.Assert(t, errors.Is(err, ctxdb.ErrTenantMismatch), "unexpected error: %v", err)
+	})
+
+	t.Run("no tenant", func(t *testing.T) {
+		s := db.NewSession(context.Background())
+		defer s.Close()
+		var orders []tenantOrder
+		err := s.Find(&orders)
+		test.Assert(t, errors.Is(err, ctxdb.ErrNoTenant), "unexpected error: %v", err)
+
+		// other tables are not scoped
+		_, err = s.Exec("UPDATE store SET name = ? WHERE id = ?", "a", 1)
+		test.Ok(t, err)
+	})
+
+	t.Run("without tenant", func(t *testing.T) {
+		s := db.NewSession(ctxdb.WithoutTenant(context.Background()))
+		defer s.Close()
+		fake.Reset()
+		var orders []tenantOrder
+		test.Ok(t, s.Find(&orders))
+		test.Equals(t, "SELECT `id`, `tenant_code`, `name` FROM `order`", statements(fake.Log()))
+	})
+
+	t.Run("behaviorlog", func(t *testing.T) {
+		c := &behaviorlog.LogContext{TenantCode: "pangpang"}
+		s := db.NewSession(c.ToCtx(context.Background()))
+		defer s.Close()
+		fake.Reset()
+		var orders []tenantOrder
+		test.Ok(t, s.Find(&orders))
+		test.Equals(t, [][]interface{}{{"pangpang"}}, fake.Args())
+	})
+}
+
+func TestNewEngine(t *testing.T) {
+	_, fake := newFakeEngine(t)
+	engine, err := ctxdb.NewEngine("fakedb", t.Name())
+	test.Ok(t, err)
+	engine.SetMaxOpenConns(5)
+	engine.SetMaxIdleConns(0)
+	db := ctxdb.New(engine, "test", kafka.Config{}, ctxdb.TenantTables("order"))
+	defer db.Close()
+
+	session := db.NewSession(ctxdb.WithTenant(context.Background(), "pangpang"))
+	defer session.Close()
+	var orders []tenantOrder
+	test.Ok(t, session.Find(&orders))
+	test.Equals(t, [][]interface{}{{"pangpang"}}, fake.Args())
+
+	// the settings of the connection pool are kept
+	stats := engine.DB().Stats()
+	test.Equals(t, 5, stats.MaxOpenConnections)
+	test.Equals(t, 0, stats.Idle)
+}
@@ -0,0 +1,133 @@
+package ctxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"xorm.io/xorm"
+)
+
+var ErrNoSession = errors.New("ctxdb: no session in the context")
+
+type TxOptions struct {
+	// Name is the name of the session in the context, see ToCtxWithName.
+	Name string
+	// Savepoint makes a nested transaction roll back to a savepoint on error, instead of joining the outer transaction.
+	Savepoint bool
+	// MaxRetries is how many times the transaction is re-run on retryable errors, see Retry.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Retryable  func(error) bool
+}
+
+func TxName(name string) func(*TxOptions) {
+	return func(o *TxOptions) {
+		o.Name = name
+	}
+}
+
+func Savepoint() func(*TxOptions) {
+	return func(o *TxOptions) {
+		o.Savepoint = true
+	}
+}
+
+type txKey struct {
+	name string
+}
+
+// WithTx runs fn in a transaction of the session in ctx, which is committed if fn returns nil,
+// and rolled back if fn returns an error or panics.
+//
+// If the session is of a replica, fn gets a new session of the primary.
+// If the session is already in a transaction (e.g. started by echomiddleware.ContextDB or an outer WithTx),
+// fn joins it and its error is returned to the outer transaction as is.
+// With the Savepoint option, the changes of fn are rolled back to a savepoint instead, and the outer transaction continues.
+// With the Retry option, a transaction started by WithTx is re-run on deadlocks and lock wait timeouts;
+// in a joined transaction, Retry is ignored with a warning.
+func WithTx(ctx context.Context, fn func(ctx context.Context) error, options ...func(*TxOptions)) error {
+	o := newTxOptions(options...)
+	session := FromCtxWithName(ctx, o.Name)
+	if session == nil {
+		return ErrNoSession
+	}
+	if db := primaryOf(session); db != nil {
+		// transactions always go to the primary
+		session = db.NewSession(WithReadOnly(ctx, false))
+		defer session.Close()
+		ctx = ToCtxWithName(ctx, o.Name, session)
+	}
+
+	depth, _ := ctx.Value(txKey{o.Name}).(int)
+	nested := context.WithValue(ctx, txKey{o.Name}, depth+1)
+	if !inTx(session, depth) {
+		return o.retry(ctx, session.Engine().Logger(), func(int) error {
+			return runTx(nested, fn, session.Begin, session.Commit, session.Rollback)
+		})
+	}
+	if o.MaxRetries > 0 {
+		logIgnoredRetry(ctx, session.Engine().Logger(), o.MaxRetries)
+	}
+	if !o.Savepoint {
+		return fn(nested)
+	}
+
+	savepoint := fmt.Sprintf("ctxdb_sp_%d", depth+1)
+	return runTx(nested, fn,
+		func() error { return exec(session, "SAVEPOINT "+savepoint) },
+		func() error { return exec(session, "RELEASE SAVEPOINT "+savepoint) },
+		func() error { return exec(session, "ROLLBACK TO SAVEPOINT "+savepoint) },
+	)
+}
+
+func newTxOptions(options ...func(*TxOptions)) TxOptions {
+	o := TxOptions{
+		Name:       DefaultName,
+		MinBackoff: DefaultRetryMinBackoff,
+		MaxBackoff: DefaultRetryMaxBackoff,
+		Retryable:  IsRetryable,
+	}
+	for _, option := range options {
+		if option != nil {
+			option(&o)
+		}
+	}
+	return o
+}
+
+func runTx(ctx context.Context, fn func(ctx context.Context) error, begin, commit, rollback func() error) (err error) {
+	if err := begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+		if err != nil {
+			rollback()
+			return
+		}
+		err = commit()
+	}()
+	return fn(ctx)
+}
+
+func exec(session *xorm.Session, sql string) error {
+	_, err := session.Exec(sql)
+	return err
+}
+
+// inTx reports whether session is in a transaction.
+// xorm doesn't export it, so the unexported field is read, and depth (the nesting of WithTx) is used if the field is missing.
+func inTx(session *xorm.Session, depth int) bool {
+	f := reflect.ValueOf(session).Elem().FieldByName("isAutoCommit")
+	if !f.IsValid() || f.Kind() != reflect.Bool {
+		return depth > 0
+	}
+	return !f.Bool()
+}
@@ -0,0 +1,83 @@
+package ctxdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestWithTx(t *testing.T) {
+	engine, db := newFakeEngine(t)
+	session := engine.NewSession()
+	defer session.Close()
+	ctx := ctxdb.ToCtx(context.Background(), session)
+
+	insert := func(ctx context.Context) error {
+		_, err := ctxdb.FromCtx(ctx).Exec("INSERT INTO t VALUES (1)")
+		return err
+	}
+	errFailed := errors.New("failed")
+
+	t.Run("commit", func(t *testing.T) {
+		db.Reset()
+		test.Ok(t, ctxdb.WithTx(ctx, insert))
+		test.Equals(t, "BEGIN; INSERT INTO t VALUES (1); COMMIT", statements(db.Log()))
+	})
+	t.Run("rollback", func(t *testing.T) {
+		db.Reset()
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			insert(ctx)
+			return errFailed
+		})
+		test.Equals(t, errFailed, err)
+		test.Equals(t, "BEGIN; INSERT INTO t VALUES (1); ROLLBACK", statements(db.Log()))
+	})
+	t.Run("panic", func(t *testing.T) {
+		db.Reset()
+		defer func() {
+			test.Equals(t, "boom", recover())
+			test.Equals(t, "BEGIN; INSERT INTO t VALUES (1); ROLLBACK", statements(db.Log()))
+		}()
+		ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			insert(ctx)
+			panic("boom")
+		})
+	})
+	t.Run("join", func(t *testing.T) {
+		db.Reset()
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			return ctxdb.WithTx(ctx, insert)
+		})
+		test.Ok(t, err)
+		test.Equals(t, "BEGIN; INSERT INTO t VALUES (1); COMMIT", statements(db.Log()))
+	})
+	t.Run("savepoint", func(t *testing.T) {
+		db.Reset()
+		err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+			test.Ok(t, insert(ctx))
+			err := ctxdb.WithTx(ctx, func(ctx context.Context) error {
+				insert(ctx)
+				return errFailed
+			}, ctxdb.Savepoint())
+			test.Equals(t, errFailed, err)
+			return ctxdb.WithTx(ctx, insert, ctxdb.Savepoint())
+		})
+		test.Ok(t, err)
+		test.Equals(t, "BEGIN; INSERT INTO t VALUES (1); "+
+			"SAVEPOINT ctxdb_sp_2; INSERT INTO t VALUES (1); ROLLBACK TO SAVEPOINT ctxdb_sp_2; "+
+			"SAVEPOINT ctxdb_sp_2; INSERT INTO t VALUES (1); RELEASE SAVEPOINT ctxdb_sp_2; COMMIT", statements(db.Log()))
+	})
+	t.Run("outer transaction", func(t *testing.T) {
+		db.Reset()
+		test.Ok(t, session.Begin())
+		test.Ok(t, ctxdb.WithTx(ctx, insert))
+		test.Equals(t, "BEGIN; INSERT INTO t VALUES (1)", statements(db.Log()))
+		test.Ok(t, session.Rollback())
+	})
+	t.Run("no session", func(t *testing.T) {
+		test.Equals(t, ctxdb.ErrNoSession, ctxdb.WithTx(context.Background(), insert))
+	})
+}
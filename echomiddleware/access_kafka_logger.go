@@ -14,6 +14,26 @@ import (
 	"github.com/pangpanglabs/goutils/kafka"
 )
 
+type requestIDKey struct{}
+
+func RequestIDToCtx(ctx context.Context, requestID string) context.Context {
+	// the old key is still set for code that reads it directly
+	return context.WithValue(context.WithValue(ctx, "request_id", requestID), requestIDKey{}, requestID)
+}
+
+// RequestIDFromCtx returns the request ID set by AccessLogger.
+// It also looks up the old "request_id" key during the deprecation period.
+func RequestIDFromCtx(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return requestID
+	}
+	requestID, _ := ctx.Value("request_id").(string)
+	return requestID
+}
+
 type TeeReadCloser struct {
 	io.Reader
 }
@@ -51,15 +71,7 @@ func AccessLogger(serviceName string, config KafkaConfig) echo.MiddlewareFunc {
 			if request_id == "" {
 				request_id = res.Header().Get(echo.HeaderXRequestID)
 			}
-			c.SetRequest(
-				req.WithContext(
-					context.WithValue(
-						req.Context(),
-						"request_id",
-						request_id,
-					),
-				),
-			)
+			c.SetRequest(req.WithContext(RequestIDToCtx(req.Context(), request_id)))
 
 			start := time.Now()
 			if err = next(c); err != nil {
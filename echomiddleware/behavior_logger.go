@@ -2,7 +2,6 @@ package echomiddleware
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -56,9 +55,7 @@ func BehaviorLogger(serviceName string, config kafka.Config, options ...func(*be
 				req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 			}
 
-			c.SetRequest(req.WithContext(context.WithValue(req.Context(),
-				behaviorlog.LogContextName, behaviorLogger,
-			)))
+			c.SetRequest(req.WithContext(behaviorLogger.ToCtx(req.Context())))
 
 			if err = next(c); err != nil {
 				c.Error(err)
@@ -1,27 +1,25 @@
 package echomiddleware
 
 import (
-	"context"
-
 	"github.com/labstack/echo"
 	"github.com/pangpanglabs/goutils/ctxbase"
 )
 
+// ContextBase puts a ctxbase.ContextBase into the request context.
+// The W3C trace context and baggage are continued from the traceparent/tracestate headers, or a new trace is started.
+// X-Request-ID falls back to the trace ID, and X-Request-ID and traceparent are set on the response.
 func ContextBase() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			req := c.Request()
-			rid := req.Header.Get(echo.HeaderXRequestID)
-			if rid == "" {
-				rid = ctxbase.NewID()
+			cb := ctxbase.Extract(req.Header)
+			c.Response().Header().Set(echo.HeaderXRequestID, cb.RequestID)
+			c.Response().Header().Set(ctxbase.HeaderTraceparent, cb.Traceparent())
+			if cb.TraceState != "" {
+				c.Response().Header().Set(ctxbase.HeaderTracestate, cb.TraceState)
 			}
-			c.Response().Header().Set(echo.HeaderXRequestID, rid)
 
-			cb := ctxbase.ContextBase{
-				RequestID: rid,
-				ActionID:  ctxbase.NewID(),
-			}
-			c.SetRequest(req.WithContext(context.WithValue(req.Context(), ctxbase.ContextBaseName, &cb)))
+			c.SetRequest(req.WithContext(cb.ToCtx(req.Context())))
 			return next(c)
 		}
 	}
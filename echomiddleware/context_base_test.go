@@ -0,0 +1,35 @@
+package echomiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextBase(t *testing.T) {
+	e := echo.New()
+	var cb *ctxbase.ContextBase
+	e.Pre(ContextBase())
+	e.GET("/", func(c echo.Context) error {
+		cb = ctxbase.FromCtx(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(ctxbase.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(ctxbase.HeaderTracestate, "congo=t61rcWkgMzE")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.NotNil(t, cb)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", cb.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", cb.ParentSpanID)
+	assert.Equal(t, cb.TraceID, cb.RequestID)
+	assert.Equal(t, cb.RequestID, rec.Header().Get(echo.HeaderXRequestID))
+	assert.Equal(t, cb.Traceparent(), rec.Header().Get(ctxbase.HeaderTraceparent))
+	assert.Equal(t, "congo=t61rcWkgMzE", rec.Header().Get(ctxbase.HeaderTracestate))
+}
@@ -1,7 +1,9 @@
 package echomiddleware
 
 import (
-	"context"
+	"bytes"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 
@@ -11,47 +13,85 @@ import (
 	"xorm.io/xorm"
 )
 
-type ContextDBType string
+// Deprecated: sessions are put into the context with ctxdb.ToCtxWithName, use ctxdb.FromCtx to get them.
+type ContextDBType = ctxdb.ContextDBType
 
-var ContextDBName ContextDBType = "DB"
+var ContextDBName ContextDBType = ctxdb.DefaultName
 
-func ContextDB(service string, xormEngine *xorm.Engine, kafkaConfig kafka.Config) echo.MiddlewareFunc {
-	return ContextDBWithName(service, ContextDBName, xormEngine, kafkaConfig)
+// ContextDB puts a session into the request context. Sessions of GET and HEAD requests go to a replica if there are replicas
+// (see ctxdb.Replicas), unless the context is marked by ctxdb.WithReadOnly.
+// Requests of other methods run in a transaction, which is re-run with the request body rewound if it fails with a retryable
+// error and the retry policy is set by ctxdb.TxRetry, unless the response has been written.
+func ContextDB(service string, xormEngine *xorm.Engine, kafkaConfig kafka.Config, options ...func(*ctxdb.ContextDB)) echo.MiddlewareFunc {
+	return ContextDBWithName(service, ContextDBName, xormEngine, kafkaConfig, options...)
 }
-func ContextDBWithName(service string, contexDBName ContextDBType, xormEngine *xorm.Engine, kafkaConfig kafka.Config) echo.MiddlewareFunc {
-	db := ctxdb.New(xormEngine, service, kafkaConfig)
+func ContextDBWithName(service string, contexDBName ContextDBType, xormEngine *xorm.Engine, kafkaConfig kafka.Config, options ...func(*ctxdb.ContextDB)) echo.MiddlewareFunc {
+	db := ctxdb.New(xormEngine, service, kafkaConfig, options...)
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			req := c.Request()
 			ctx := req.Context()
-
-			session := db.NewSession(ctx)
-			defer session.Close()
-
-			c.SetRequest(req.WithContext(context.WithValue(ctx, contexDBName, session)))
+			if _, ok := ctxdb.ReadOnlyFromCtx(ctx); !ok && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+				ctx = ctxdb.WithReadOnly(ctx, true)
+			}
 
 			switch req.Method {
 			case "POST", "PUT", "DELETE", "PATCH":
+			default:
+				session := db.NewSession(ctx)
+				defer session.Close()
+				c.SetRequest(req.WithContext(ctxdb.ToCtxWithName(ctx, string(contexDBName), session)))
+				return next(c)
+			}
+
+			// the body is recorded as it's read, so that it can be rewound for a retry
+			var body bytes.Buffer
+			unread := req.Body
+			if unread != nil {
+				req.Body = ioutil.NopCloser(io.TeeReader(unread, &body))
+			}
+			var result, commitErr error
+			err := db.RetryTx(ctx, func(attempt int) error {
+				if attempt > 1 && unread != nil {
+					if _, err := io.Copy(&body, unread); err != nil {
+						return err
+					}
+					req.Body = ioutil.NopCloser(bytes.NewReader(body.Bytes()))
+				}
+				session := db.NewSession(ctx)
+				defer session.Close()
+				c.SetRequest(req.WithContext(ctxdb.ToCtxWithName(ctx, string(contexDBName), session)))
+
 				if err := session.Begin(); err != nil {
 					log.Println(err)
 				}
-				if err := next(c); err != nil {
+				err := next(c)
+				switch {
+				case err != nil:
 					session.Rollback()
-					return err
-				}
-				if c.Response().Status >= 500 {
+				case c.Response().Status >= 500:
 					session.Rollback()
 					return nil
+				default:
+					if err = session.Commit(); err != nil {
+						commitErr = err
+					}
 				}
-				if err := session.Commit(); err != nil {
-					return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+				if err != nil && c.Response().Committed {
+					// the response can't be written again
+					result = err
+					return nil
 				}
-			default:
-				return next(c)
+				return err
+			})
+			if err == nil {
+				err = result
 			}
-
-			return nil
+			if err != nil && err == commitErr {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			return err
 		}
 	}
 }
@@ -0,0 +1,112 @@
+package echomiddleware
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/pangpanglabs/goutils/ctxdb"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/stretchr/testify/assert"
+	"xorm.io/xorm"
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/schemas"
+)
+
+// mysqlError is like the error of go-sql-driver/mysql.
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string { return e.Message }
+
+func TestContextDBRetry(t *testing.T) {
+	engine, err := xorm.NewEngine("echomiddleware-fakedb", "")
+	assert.Nil(t, err)
+	sink := ctxdb.NewMemorySink()
+
+	e := echo.New()
+	e.Use(ContextDB("test", engine, kafka.Config{},
+		ctxdb.WithSqlLogSink(sink),
+		ctxdb.TxRetry(ctxdb.Retry(2), ctxdb.RetryBackoff(0, 0)),
+	))
+	var bodies []string
+	e.POST("/", func(c echo.Context) error {
+		body, _ := ioutil.ReadAll(c.Request().Body)
+		bodies = append(bodies, string(body))
+		if _, err := ctxdb.FromCtx(c.Request().Context()).Exec("UPDATE t SET a = 1"); err != nil {
+			return err
+		}
+		if len(bodies) == 1 {
+			return &mysqlError{Number: 1213, Message: "Error 1213: Deadlock found when trying to get lock"}
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body")))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"body", "body"}, bodies)
+	assert.Equal(t, "BEGIN; UPDATE t SET a = 1; ROLLBACK; BEGIN; UPDATE t SET a = 1; COMMIT", strings.Join(fakeStatements.get(), "; "))
+	var retries int
+	for _, log := range sink.Logs() {
+		if log.Retry != 0 {
+			retries++
+		}
+	}
+	assert.Equal(t, 1, retries)
+}
+
+// fakeLog is the log of the statements run by fakeDriver.
+type fakeLog struct {
+	sync.Mutex
+	log []string
+}
+
+var fakeStatements fakeLog
+
+func (s *fakeLog) record(query string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.log = append(s.log, query)
+	return nil
+}
+
+func (s *fakeLog) get() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+func init() {
+	sql.Register("echomiddleware-fakedb", fakeDriver{})
+	dialects.RegisterDriver("echomiddleware-fakedb", fakeDriver{})
+}
+
+// fakeDriver records the statements, so that ContextDB can be tested without a database.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeDriver) Parse(driverName, dataSourceName string) (*dialects.URI, error) {
+	return &dialects.URI{DBType: schemas.MYSQL, DBName: "test"}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)               { return c, fakeStatements.record("BEGIN") }
+func (fakeConn) Commit() error                             { return fakeStatements.record("COMMIT") }
+func (fakeConn) Rollback() error                           { return fakeStatements.record("ROLLBACK") }
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), fakeStatements.record(query)
+}
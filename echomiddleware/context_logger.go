@@ -10,8 +10,30 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ContextLoggerName is the old context key of the logger, which is still set by LoggerToCtx and looked up by LoggerFromCtx.
+//
+// Deprecated: use LoggerFromCtx and LoggerToCtx.
 const ContextLoggerName = "ContextLogger"
 
+type loggerKey struct{}
+
+func LoggerToCtx(ctx context.Context, logEntry *logrus.Entry) context.Context {
+	// the old key is still set for code that reads it directly
+	return context.WithValue(context.WithValue(ctx, ContextLoggerName, logEntry), loggerKey{}, logEntry)
+}
+
+// LoggerFromCtx returns the logger set by ContextLogger, or nil.
+func LoggerFromCtx(ctx context.Context) *logrus.Entry {
+	if ctx == nil {
+		return nil
+	}
+	if logEntry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return logEntry
+	}
+	logEntry, _ := ctx.Value(ContextLoggerName).(*logrus.Entry)
+	return logEntry
+}
+
 func ContextLogger() echo.MiddlewareFunc {
 	logger := logrus.New()
 	logger.Level = logrus.DebugLevel
@@ -37,7 +59,7 @@ func ContextLogger() echo.MiddlewareFunc {
 			logEntry = logEntry.WithField("request_id", id)
 
 			req := c.Request()
-			c.SetRequest(req.WithContext(context.WithValue(req.Context(), ContextLoggerName, logEntry)))
+			c.SetRequest(req.WithContext(LoggerToCtx(req.Context(), logEntry)))
 
 			return next(c)
 		}
@@ -0,0 +1,38 @@
+package echomiddleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextLogger(t *testing.T) {
+	e := echo.New()
+	var logEntry *logrus.Entry
+	e.Use(ContextLogger())
+	e.GET("/", func(c echo.Context) error {
+		logEntry = LoggerFromCtx(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.NotNil(t, logEntry)
+	assert.Equal(t, "req-1", logEntry.Data["request_id"])
+
+	// the old keys are still set and supported
+	entry := logrus.NewEntry(logrus.New())
+	assert.Equal(t, entry, LoggerToCtx(context.Background(), entry).Value(ContextLoggerName))
+	assert.Equal(t, "req-2", RequestIDToCtx(context.Background(), "req-2").Value("request_id"))
+	assert.Equal(t, entry, LoggerFromCtx(context.WithValue(context.Background(), ContextLoggerName, entry)))
+	assert.Equal(t, "req-1", RequestIDFromCtx(context.WithValue(context.Background(), "request_id", "req-1")))
+	assert.Equal(t, "req-2", RequestIDFromCtx(RequestIDToCtx(context.Background(), "req-2")))
+	assert.Nil(t, LoggerFromCtx(context.Background()))
+}
@@ -2,7 +2,10 @@ package echotpl
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+
+	"github.com/pangpanglabs/goutils/number"
 )
 
 func loop(ints ...int64) (<-chan int64, error) {
@@ -233,3 +236,73 @@ func modulo(b, a interface{}) (interface{}, error) {
 		return nil, fmt.Errorf("modulo: unknown type for %q (%T)", av, a)
 	}
 }
+
+// formatNumber prints v like number.Format, e.g. {{formatNumber "en-US" .Price}}.
+func formatNumber(locale string, v interface{}, setting ...*number.Setting) (string, error) {
+	d, err := toDecimal(v)
+	if err != nil {
+		return "", fmt.Errorf("formatNumber: %v", err)
+	}
+	return number.Format(d, locale, firstSetting(setting))
+}
+
+// formatCurrency prints v like number.FormatCurrency, e.g. {{formatCurrency "zh-CN" "CNY" .Price}}.
+// v can also be a number.Money, then currency is ignored.
+func formatCurrency(locale, currency string, v interface{}, setting ...*number.Setting) (string, error) {
+	m, ok := v.(number.Money)
+	if !ok {
+		d, err := toDecimal(v)
+		if err != nil {
+			return "", fmt.Errorf("formatCurrency: %v", err)
+		}
+		if m, err = number.NewMoneyRound(d, currency, firstSetting(setting)); err != nil {
+			return "", fmt.Errorf("formatCurrency: %v", err)
+		}
+	}
+	return number.FormatCurrency(m, locale, firstSetting(setting))
+}
+
+// formatPercent prints v like number.FormatPercent, e.g. {{formatPercent "ko-KR" .DiscountRate}}.
+func formatPercent(locale string, v interface{}, setting ...*number.Setting) (string, error) {
+	d, err := toDecimal(v)
+	if err != nil {
+		return "", fmt.Errorf("formatPercent: %v", err)
+	}
+	return number.FormatPercent(d, locale, firstSetting(setting))
+}
+
+func firstSetting(setting []*number.Setting) *number.Setting {
+	if len(setting) == 0 {
+		return nil
+	}
+	return setting[0]
+}
+
+func toDecimal(v interface{}) (number.Decimal, error) {
+	switch d := v.(type) {
+	case number.Decimal:
+		return d, nil
+	case *number.Decimal:
+		return *d, nil
+	case string:
+		return number.ParseDecimal(d)
+	case fmt.Stringer:
+		return number.ParseDecimal(d.String())
+	}
+
+	av := reflect.ValueOf(v)
+	switch av.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number.NewDecimal(av.Int(), 0), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return number.ParseDecimal(fmt.Sprint(av.Uint()))
+	case reflect.Float32, reflect.Float64:
+		f := av.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return number.Decimal{}, fmt.Errorf("unsupported number %v", f)
+		}
+		return number.NewDecimalFromFloat(f), nil
+	default:
+		return number.Decimal{}, fmt.Errorf("unknown type for %q (%T)", av, v)
+	}
+}
@@ -28,6 +28,10 @@ func New() *Template {
 				"multiply": multiply,
 				"divide":   divide,
 				"modulo":   modulo,
+				// Format functions
+				"formatNumber":   formatNumber,
+				"formatCurrency": formatCurrency,
+				"formatPercent":  formatPercent,
 			})
 			if err := filepath.Walk("views", func(path string, info os.FileInfo, err error) error {
 				if strings.Contains(path, ".html") {
@@ -2,6 +2,7 @@ package httpreq
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/pangpanglabs/goutils/behaviorlog"
+	"github.com/pangpanglabs/goutils/ctxbase"
 )
 
 const DefaultMaxIdleConnsPerHost = 100
@@ -31,6 +33,7 @@ type HttpReq struct {
 	Req          *http.Request
 	ReqDataType  formatType
 	RespDataType formatType
+	ctx          context.Context
 	err          error
 }
 
@@ -67,9 +70,35 @@ func New(method, url string, param interface{}, options ...OptionFunc) *HttpReq
 	if httpReq.err != nil {
 		return httpReq
 	}
+	if httpReq.ctx != nil {
+		httpReq.Req = httpReq.Req.WithContext(httpReq.ctx)
+	}
 	return httpReq
 }
 
+// Context is the option of WithContext, e.g. httpreq.New(http.MethodGet, url, nil, httpreq.Context(ctx)).
+func Context(ctx context.Context) OptionFunc {
+	return func(r *HttpReq) error {
+		r.ctx = ctx
+		return nil
+	}
+}
+
+// WithContext sets ctx to the request, which is canceled with ctx.
+// The request ID, action ID, W3C trace context and baggage of the ctxbase.ContextBase of the request context
+// are propagated when the request is called, unless the headers are set, e.g. by WithRequestID.
+func (r *HttpReq) WithContext(ctx context.Context) *HttpReq {
+	if r.err != nil {
+		return r
+	}
+
+	if ctx != nil {
+		r.Req = r.Req.WithContext(ctx)
+	}
+
+	return r
+}
+
 func (r *HttpReq) WithToken(token string) *HttpReq {
 	if r.err != nil {
 		return r
@@ -125,6 +154,39 @@ func (r *HttpReq) WithBehaviorLogContext(logContext *behaviorlog.LogContext) *Ht
 	return r
 }
 
+// WithContextBase propagates the request ID, action ID, W3C trace context and baggage of cb.
+func (r *HttpReq) WithContextBase(cb *ctxbase.ContextBase) *HttpReq {
+	if r.err != nil {
+		return r
+	}
+
+	if cb == nil {
+		return r
+	}
+
+	cb.Inject(r.Req.Header)
+
+	return r
+}
+
+// injectContext propagates the ctxbase.ContextBase of the request context, without overwriting headers.
+func (r *HttpReq) injectContext() {
+	if cb := ctxbase.FromCtx(r.Req.Context()); cb != nil {
+		cb.Inject(unsetHeaders{r.Req.Header})
+	}
+}
+
+// unsetHeaders is a ctxbase.Carrier which only sets headers which are not set yet.
+type unsetHeaders struct {
+	http.Header
+}
+
+func (h unsetHeaders) Set(key, value string) {
+	if h.Header.Get(key) == "" {
+		h.Header.Set(key, value)
+	}
+}
+
 func (r *HttpReq) WithUserAgent(userAgent string) *HttpReq {
 	r.Req.Header.Add("User-Agent", userAgent)
 	return r
@@ -159,6 +221,7 @@ func (r *HttpReq) call(v interface{}, httpClient *http.Client) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
+	r.injectContext()
 	if len(r.Req.Header.Get("Content-Type")) == 0 {
 		r.Req.Header.Set("Content-Type", DataTypeFactory{}.New(r.ReqDataType).contentType())
 	}
@@ -198,6 +261,7 @@ func (r *HttpReq) rawCall(httpClient *http.Client) (*http.Response, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
+	r.injectContext()
 	if len(r.Req.Header.Get("Content-Type")) == 0 {
 		r.Req.Header.Set("Content-Type", DataTypeFactory{}.New(r.ReqDataType).contentType())
 	}
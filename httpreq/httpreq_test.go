@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/pangpanglabs/goutils/behaviorlog"
+	"github.com/pangpanglabs/goutils/ctxbase"
 
 	"github.com/pangpanglabs/goutils/httpreq"
 
@@ -277,3 +278,37 @@ func TestRawResponse(t *testing.T) {
 	})
 
 }
+
+func TestContextPropagation(t *testing.T) {
+	var header http.Header
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer s.Close()
+
+	cb := ctxbase.New("req-1", "", "")
+	test.Ok(t, cb.Baggage.Set("tenant", "pangpang"))
+	ctx := cb.ToCtx(context.Background())
+
+	t.Run("WithContextBase", func(t *testing.T) {
+		_, err := httpreq.New(http.MethodGet, s.URL, nil).WithContextBase(cb).Call(nil)
+		test.Ok(t, err)
+		test.Equals(t, "req-1", header.Get(ctxbase.HeaderXRequestID))
+		test.Equals(t, cb.Traceparent(), header.Get(ctxbase.HeaderTraceparent))
+		test.Equals(t, "tenant=pangpang", header.Get(ctxbase.HeaderBaggage))
+	})
+	t.Run("Context", func(t *testing.T) {
+		_, err := httpreq.New(http.MethodGet, s.URL, nil, httpreq.Context(ctx)).Call(nil)
+		test.Ok(t, err)
+		test.Equals(t, "req-1", header.Get(ctxbase.HeaderXRequestID))
+		test.Equals(t, cb.ActionID, header.Get(ctxbase.HeaderXActionID))
+		test.Equals(t, cb.Traceparent(), header.Get(ctxbase.HeaderTraceparent))
+		test.Equals(t, "tenant=pangpang", header.Get(ctxbase.HeaderBaggage))
+	})
+	t.Run("WithContext keeps headers", func(t *testing.T) {
+		_, err := httpreq.New(http.MethodGet, s.URL, nil).WithContext(ctx).WithRequestID("req-2").Call(nil)
+		test.Ok(t, err)
+		test.Equals(t, "req-2", header.Get(ctxbase.HeaderXRequestID))
+		test.Equals(t, "tenant=pangpang", header.Get(ctxbase.HeaderBaggage))
+	})
+}
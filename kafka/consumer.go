@@ -93,3 +93,12 @@ func (c *Consumer) Messages() (<-chan *sarama.ConsumerMessage, error) {
 
 	return messages, nil
 }
+
+// ContextMessages is like Messages, and the messages have the context propagated by the producer.
+func (c *Consumer) ContextMessages() (<-chan *ContextMessage, error) {
+	messages, err := c.Messages()
+	if err != nil {
+		return nil, err
+	}
+	return WithContext(messages), nil
+}
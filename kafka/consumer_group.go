@@ -58,6 +58,11 @@ func NewConsumerGroup(groupId string, brokers []string, topic string, options ..
 func (c *ConsumerGroupHandler) Messages() (<-chan *sarama.ConsumerMessage, error) {
 	return c.messages, nil
 }
+
+// ContextMessages is like Messages, and the messages have the context propagated by the producer.
+func (c *ConsumerGroupHandler) ContextMessages() (<-chan *ContextMessage, error) {
+	return WithContext(c.messages), nil
+}
 func (c *ConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for m := range claim.Messages() {
 		c.messages <- m
@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/pangpanglabs/goutils/ctxbase"
+)
+
+// producerHeaders is a ctxbase.Carrier of the headers of a message to send.
+type producerHeaders struct {
+	msg *sarama.ProducerMessage
+}
+
+func (h producerHeaders) Get(key string) string {
+	for _, header := range h.msg.Headers {
+		if strings.EqualFold(string(header.Key), key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h producerHeaders) Set(key, value string) {
+	for i, header := range h.msg.Headers {
+		if strings.EqualFold(string(header.Key), key) {
+			h.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	h.msg.Headers = append(h.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// consumerHeaders is a ctxbase.Carrier of the headers of a received message.
+type consumerHeaders struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (h consumerHeaders) Get(key string) string {
+	for _, header := range h.msg.Headers {
+		if header != nil && strings.EqualFold(string(header.Key), key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h consumerHeaders) Set(key, value string) {
+	for _, header := range h.msg.Headers {
+		if header != nil && strings.EqualFold(string(header.Key), key) {
+			header.Value = []byte(value)
+			return
+		}
+	}
+	h.msg.Headers = append(h.msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// InjectContext sets the request ID, trace context and baggage of the ctxbase.ContextBase of ctx to the message headers.
+func InjectContext(ctx context.Context, msg *sarama.ProducerMessage) {
+	if cb := ctxbase.FromCtx(ctx); cb != nil {
+		cb.Inject(producerHeaders{msg})
+	}
+}
+
+// ContextFromMessage returns a context with the ctxbase.ContextBase extracted from the message headers,
+// so that the request ID, trace and baggage of the producer are continued by the consumer.
+func ContextFromMessage(ctx context.Context, msg *sarama.ConsumerMessage) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return ctxbase.Extract(consumerHeaders{msg}).ToCtx(ctx)
+}
+
+// ContextMessage is a received message with the context of ContextFromMessage.
+type ContextMessage struct {
+	*sarama.ConsumerMessage
+	Ctx context.Context
+}
+
+// WithContext returns the messages of messages with their contexts, so that consumers continue the request ID,
+// trace and baggage of the producer without calling ContextFromMessage.
+func WithContext(messages <-chan *sarama.ConsumerMessage) <-chan *ContextMessage {
+	out := make(chan *ContextMessage, cap(messages))
+	go func() {
+		defer close(out)
+		for m := range messages {
+			out <- &ContextMessage{ConsumerMessage: m, Ctx: ContextFromMessage(context.Background(), m)}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,52 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/pangpanglabs/goutils/ctxbase"
+	"github.com/pangpanglabs/goutils/kafka"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestContextPropagation(t *testing.T) {
+	cb := ctxbase.New("req-1", "", "")
+	test.Ok(t, cb.Baggage.Set("tenant", "pangpang"))
+	ctx := cb.ToCtx(context.Background())
+
+	msg := &sarama.ProducerMessage{}
+	kafka.InjectContext(ctx, msg)
+
+	received := &sarama.ConsumerMessage{}
+	for i := range msg.Headers {
+		received.Headers = append(received.Headers, &msg.Headers[i])
+	}
+	next := ctxbase.FromCtx(kafka.ContextFromMessage(context.Background(), received))
+	test.Equals(t, "req-1", next.RequestID)
+	test.Equals(t, cb.TraceID, next.TraceID)
+	test.Equals(t, cb.SpanID, next.ParentSpanID)
+	test.Equals(t, "pangpang", next.Baggage.Get("tenant"))
+}
+
+func TestWithContext(t *testing.T) {
+	cb := ctxbase.New("req-1", "", "")
+	msg := &sarama.ProducerMessage{}
+	kafka.InjectContext(cb.ToCtx(context.Background()), msg)
+
+	messages := make(chan *sarama.ConsumerMessage, 1)
+	received := &sarama.ConsumerMessage{Offset: 1}
+	for i := range msg.Headers {
+		received.Headers = append(received.Headers, &msg.Headers[i])
+	}
+	messages <- received
+	close(messages)
+
+	var got []*kafka.ContextMessage
+	for m := range kafka.WithContext(messages) {
+		got = append(got, m)
+	}
+	test.Equals(t, 1, len(got))
+	test.Equals(t, int64(1), got[0].Offset)
+	test.Equals(t, "req-1", ctxbase.FromCtx(got[0].Ctx).RequestID)
+}
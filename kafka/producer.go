@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -11,6 +12,8 @@ import (
 type Producer struct {
 	topic    string
 	producer sarama.AsyncProducer
+	// headers are supported from Kafka 0.11
+	headers bool
 }
 
 func NewProducer(brokers []string, topic string, options ...func(*sarama.Config)) (*Producer, error) {
@@ -18,22 +21,56 @@ func NewProducer(brokers []string, topic string, options ...func(*sarama.Config)
 	for _, option := range options {
 		option(kafkaConfig)
 	}
+	// successes and errors are returned to the callbacks of messages
+	kafkaConfig.Producer.Return.Successes = true
+	kafkaConfig.Producer.Return.Errors = true
 
 	producer, err := sarama.NewAsyncProducer(brokers, kafkaConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	return newProducer(producer, topic, kafkaConfig), nil
+}
+
+func newProducer(producer sarama.AsyncProducer, topic string, kafkaConfig *sarama.Config) *Producer {
+	// successes and errors are drained by a goroutine, so that callbacks are called one by one
 	go func() {
-		for err := range producer.Errors() {
-			log.Printf("Failed to send log entry to kafka : %v\n", err)
+		successes, errors := producer.Successes(), producer.Errors()
+		for successes != nil || errors != nil {
+			select {
+			case msg, ok := <-successes:
+				if !ok {
+					successes = nil
+					continue
+				}
+				if callback, ok := msg.Metadata.(Callback); ok && callback != nil {
+					callback(msg.Partition, msg.Offset, nil)
+				}
+			case err, ok := <-errors:
+				if !ok {
+					errors = nil
+					continue
+				}
+				if callback, ok := err.Msg.Metadata.(Callback); ok && callback != nil {
+					callback(err.Msg.Partition, err.Msg.Offset, err.Err)
+				} else {
+					log.Printf("Failed to send log entry to kafka : %v\n", err)
+				}
+			}
 		}
 	}()
 
 	return &Producer{
 		topic:    topic,
 		producer: producer,
-	}, nil
+		headers:  kafkaConfig.Version.IsAtLeast(sarama.V0_11_0_0),
+	}
+}
+
+// Topic returns the topic messages are sent to.
+func (p *Producer) Topic() string {
+	return p.topic
 }
 
 func (p *Producer) Send(v interface{}) error {
@@ -83,6 +120,112 @@ func (p *Producer) SendWithKey(v interface{}, key string) error {
 	return nil
 }
 
+// SendContext is like Send, and propagates the ctxbase.ContextBase of ctx in the message headers.
+// Headers require sarama.Config.Version to be V0_11_0_0 or later, otherwise they are not sent.
+// It returns ctx.Err() if ctx is done before the producer takes the message.
+func (p *Producer) SendContext(ctx context.Context, v interface{}) error {
+	return p.send(ctx, v, "", nil)
+}
+
+// SendWithKeyContext is like SendWithKey, and propagates the ctxbase.ContextBase of ctx in the message headers.
+func (p *Producer) SendWithKeyContext(ctx context.Context, v interface{}, key string) error {
+	if key == "" {
+		log.Println("producer Key is empty")
+		return fmt.Errorf("producer Key is empty")
+	}
+	return p.send(ctx, v, key, nil)
+}
+
+// Callback is called with the partition and offset of a message after it's acknowledged by the broker
+// (according to sarama.Config.Producer.RequiredAcks), or with the error if it failed.
+// Callbacks are called one by one, so they should not block.
+type Callback func(partition int32, offset int64, err error)
+
+// SendCallback is like SendContext, and calls callback when the message is acknowledged or failed.
+func (p *Producer) SendCallback(ctx context.Context, v interface{}, callback Callback) error {
+	return p.send(ctx, v, "", callback)
+}
+
+// SendWithKeyCallback is like SendWithKeyContext, and calls callback when the message is acknowledged or failed.
+func (p *Producer) SendWithKeyCallback(ctx context.Context, v interface{}, key string, callback Callback) error {
+	if key == "" {
+		log.Println("producer Key is empty")
+		return fmt.Errorf("producer Key is empty")
+	}
+	return p.send(ctx, v, key, callback)
+}
+
+// SendSync is like SendContext, and waits until the message is acknowledged, returning its partition and offset.
+// If ctx is done before, it returns ctx.Err(), and the message may still be sent.
+func (p *Producer) SendSync(ctx context.Context, v interface{}) (partition int32, offset int64, err error) {
+	return p.sendSync(ctx, v, "")
+}
+
+// SendWithKeySync is like SendWithKeyContext, and waits until the message is acknowledged like SendSync.
+func (p *Producer) SendWithKeySync(ctx context.Context, v interface{}, key string) (partition int32, offset int64, err error) {
+	if key == "" {
+		log.Println("producer Key is empty")
+		return -1, -1, fmt.Errorf("producer Key is empty")
+	}
+	return p.sendSync(ctx, v, key)
+}
+
+func (p *Producer) sendSync(ctx context.Context, v interface{}, key string) (int32, int64, error) {
+	type result struct {
+		partition int32
+		offset    int64
+		err       error
+	}
+	// buffered, so that the callback doesn't block if ctx is done
+	done := make(chan result, 1)
+	if err := p.send(ctx, v, key, func(partition int32, offset int64, err error) {
+		done <- result{partition, offset, err}
+	}); err != nil {
+		return -1, -1, err
+	}
+	select {
+	case r := <-done:
+		return r.partition, r.offset, r.err
+	case <-ctx.Done():
+		return -1, -1, ctx.Err()
+	}
+}
+
+func (p *Producer) send(ctx context.Context, v interface{}, key string, callback Callback) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if p == nil || p.producer == nil {
+		log.Println("Kafka producer is nil")
+		return fmt.Errorf("Kafka producer is nil")
+	}
+
+	m := p.newMessage(ctx, &sarama.ProducerMessage{
+		Topic:    p.topic,
+		Value:    sarama.ByteEncoder(msg),
+		Metadata: callback,
+	})
+	if key != "" {
+		m.Key = sarama.ByteEncoder(key)
+	}
+
+	select {
+	case p.producer.Input() <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Producer) newMessage(ctx context.Context, msg *sarama.ProducerMessage) *sarama.ProducerMessage {
+	if p.headers {
+		InjectContext(ctx, msg)
+	}
+	return msg
+}
+
 func (p *Producer) Close() error {
 	return p.producer.Close()
 }
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func newMockProducer(t *testing.T) (*Producer, *mocks.AsyncProducer) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	mock := mocks.NewAsyncProducer(t, config)
+	return newProducer(mock, "test", config), mock
+}
+
+func TestSendSync(t *testing.T) {
+	p, mock := newMockProducer(t)
+	defer p.Close()
+
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndSucceed()
+	_, offset, err := p.SendSync(context.Background(), map[string]int{"id": 1})
+	test.Ok(t, err)
+	test.Equals(t, int64(1), offset)
+	_, offset, err = p.SendWithKeySync(context.Background(), map[string]int{"id": 2}, "2")
+	test.Ok(t, err)
+	test.Equals(t, int64(2), offset)
+
+	mock.ExpectInputAndFail(errors.New("not enough replicas"))
+	_, _, err = p.SendSync(context.Background(), map[string]int{"id": 3})
+	test.Equals(t, "not enough replicas", err.Error())
+
+	_, _, err = p.SendWithKeySync(context.Background(), map[string]int{"id": 4}, "")
+	test.Assert(t, err != nil, "empty key should fail")
+}
+
+func TestSendSyncCanceled(t *testing.T) {
+	p, _ := newMockProducer(t)
+	// the broker doesn't take the message before ctx is done
+	p.producer = &blockedProducer{p.producer}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := p.SendSync(ctx, map[string]int{"id": 1})
+	test.Equals(t, context.DeadlineExceeded, err)
+}
+
+func TestSendContext(t *testing.T) {
+	p, mock := newMockProducer(t)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndSucceed()
+	test.Ok(t, p.SendContext(context.Background(), map[string]int{"id": 1}))
+	test.Ok(t, p.SendWithKeyContext(context.Background(), map[string]int{"id": 2}, "2"))
+	test.Assert(t, p.SendWithKeyContext(context.Background(), map[string]int{"id": 3}, "") != nil, "empty key should fail")
+	test.Ok(t, p.Close())
+
+	p, _ = newMockProducer(t)
+	p.producer = &blockedProducer{p.producer}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	test.Equals(t, context.DeadlineExceeded, p.SendContext(ctx, map[string]int{"id": 1}))
+	test.Equals(t, context.DeadlineExceeded, p.SendWithKeyContext(ctx, map[string]int{"id": 1}, "1"))
+}
+
+func TestSendCallback(t *testing.T) {
+	p, mock := newMockProducer(t)
+
+	type result struct {
+		offset int64
+		err    error
+	}
+	results := make(chan result, 2)
+	var running, concurrent int32
+	callback := func(partition int32, offset int64, err error) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&concurrent, 1)
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		results <- result{offset, err}
+	}
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(errors.New("message too large"))
+	test.Ok(t, p.SendCallback(context.Background(), map[string]int{"id": 1}, callback))
+	test.Ok(t, p.SendWithKeyCallback(context.Background(), map[string]int{"id": 2}, "2", callback))
+	test.Ok(t, p.Close())
+
+	// callbacks are called one by one, but successes and errors may be returned in any order
+	r1, r2 := <-results, <-results
+	test.Equals(t, int32(0), atomic.LoadInt32(&concurrent))
+	if r1.err != nil {
+		r1, r2 = r2, r1
+	}
+	test.Equals(t, result{offset: 1}, r1)
+	test.Equals(t, "message too large", r2.err.Error())
+}
+
+// blockedProducer never takes messages from its input.
+type blockedProducer struct {
+	sarama.AsyncProducer
+}
+
+func (p *blockedProducer) Input() chan<- *sarama.ProducerMessage {
+	return make(chan *sarama.ProducerMessage)
+}
@@ -1,7 +1,6 @@
 package negronimiddleware
 
 import (
-	"context"
 	"net/http"
 	"os"
 	"time"
@@ -38,9 +37,7 @@ func (b *BehaviorLogger) ServeHTTP(rw http.ResponseWriter, req *http.Request, ne
 	behaviorLogger := behaviorlog.New(b.serviceName, req, behaviorlog.KafkaProducer(b.producer))
 	behaviorLogger.Hostname = b.hostname
 
-	next(rw, req.WithContext(context.WithValue(req.Context(),
-		behaviorlog.LogContextName, behaviorLogger,
-	)))
+	next(rw, req.WithContext(behaviorLogger.ToCtx(req.Context())))
 
 	// behaviorLogger.Status = req.Response.StatusCode
 	behaviorLogger.Write()
@@ -0,0 +1,289 @@
+package number
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxDecimalExponent limits the exponent and the scale of parsed decimals (by ParseDecimal, UnmarshalJSON and Scan),
+// so that input like "1e-40000000" can't make arithmetic build numbers of millions of digits.
+const MaxDecimalExponent = 400
+
+// DivisionPrecision is the number of decimal places kept by Decimal.Div.
+var DivisionPrecision = 16
+
+// Decimal is an arbitrary-precision fixed-point decimal number: value × 10^-scale.
+// Decimal values are immutable and the zero value is 0.
+type Decimal struct {
+	value *big.Int
+	scale int32
+}
+
+var bigTen = big.NewInt(10)
+
+// NewDecimal returns value × 10^-scale, e.g. NewDecimal(1999, 2) is 19.99.
+func NewDecimal(value int64, scale int32) Decimal {
+	return Decimal{value: big.NewInt(value), scale: scale}
+}
+
+// NewDecimalFromFloat converts f using its shortest decimal representation,
+// so NewDecimalFromFloat(0.1) is exactly 0.1. It panics if f is NaN or infinite.
+func NewDecimalFromFloat(f float64) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		panic(fmt.Sprintf("number: cannot convert %v to Decimal", f))
+	}
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// ParseDecimal parses a decimal string like "-12.345" or "1.2e-3".
+// The exponent and the scale must be within ±MaxDecimalExponent.
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	var exp int64
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(str[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("number: invalid decimal %q", s)
+		}
+		exp = e
+		str = str[:i]
+	}
+
+	sign := ""
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		sign, str = str[:1], str[1:]
+	}
+
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return Decimal{}, fmt.Errorf("number: invalid decimal %q", s)
+	}
+
+	value, _ := new(big.Int).SetString(sign+intPart+fracPart, 10)
+	scale := int64(len(fracPart)) - exp
+	if exp > MaxDecimalExponent || exp < -MaxDecimalExponent || scale > MaxDecimalExponent || scale < -MaxDecimalExponent {
+		return Decimal{}, fmt.Errorf("number: decimal %q out of range", s)
+	}
+	return Decimal{value: value, scale: int32(scale)}, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics if s can't be parsed.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Decimal) val() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// rescale returns the value of d with the given scale, which must not be less than d.scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.val()
+	}
+	return new(big.Int).Mul(d.val(), pow10(int64(scale)-int64(d.scale)))
+}
+
+func pow10(n int64) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(n), nil)
+}
+
+func maxScale(d1, d2 Decimal) int32 {
+	if d1.scale > d2.scale {
+		return d1.scale
+	}
+	return d2.scale
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int32 { return d.scale }
+
+func (d Decimal) Add(d2 Decimal) Decimal {
+	scale := maxScale(d, d2)
+	return Decimal{value: new(big.Int).Add(d.rescale(scale), d2.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	scale := maxScale(d, d2)
+	return Decimal{value: new(big.Int).Sub(d.rescale(scale), d2.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	return Decimal{value: new(big.Int).Mul(d.val(), d2.val()), scale: d.scale + d2.scale}
+}
+
+// Div returns d / d2 rounded half away from zero to DivisionPrecision decimal places.
+// It panics if d2 is zero.
+func (d Decimal) Div(d2 Decimal) Decimal {
+	return d.DivRound(d2, DivisionPrecision, DefaultRoundStrategy)
+}
+
+// DivRound returns d / d2 rounded to digit decimal places with the given strategy.
+// It panics if d2 is zero.
+func (d Decimal) DivRound(d2 Decimal, digit int, strategy string) Decimal {
+	return d.DivRoundMode(d2, digit, roundModeOf(strategy))
+}
+
+// DivRoundMode is like DivRound but takes a RoundMode.
+func (d Decimal) DivRoundMode(d2 Decimal, digit int, mode RoundMode) Decimal {
+	if d2.IsZero() {
+		panic("number: division by zero")
+	}
+	// d/d2 × 10^digit = d.value × 10^(digit - d.scale + d2.scale) / d2.value
+	num, den := new(big.Int).Set(d.val()), new(big.Int).Set(d2.val())
+	if shift := int64(digit) - int64(d.scale) + int64(d2.scale); shift > 0 {
+		num.Mul(num, pow10(shift))
+	} else if shift < 0 {
+		den.Mul(den, pow10(-shift))
+	}
+	return Decimal{value: roundQuo(num, den, mode), scale: int32(digit)}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.val()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.val()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int { return d.val().Sign() }
+
+func (d Decimal) IsZero() bool { return d.Sign() == 0 }
+
+// Cmp returns -1 if d < d2, 0 if d == d2 and +1 if d > d2. Scale is ignored, so 1.5 equals 1.50.
+func (d Decimal) Cmp(d2 Decimal) int {
+	scale := maxScale(d, d2)
+	return d.rescale(scale).Cmp(d2.rescale(scale))
+}
+
+func (d Decimal) Equal(d2 Decimal) bool       { return d.Cmp(d2) == 0 }
+func (d Decimal) LessThan(d2 Decimal) bool    { return d.Cmp(d2) < 0 }
+func (d Decimal) GreaterThan(d2 Decimal) bool { return d.Cmp(d2) > 0 }
+
+// Round rounds d to digit decimal places with the given strategy, which accepts the same values as Setting.RoundStrategy.
+// Values that already have no more than digit decimal places are returned unchanged.
+func (d Decimal) Round(digit int, strategy string) Decimal {
+	return d.RoundMode(digit, roundModeOf(strategy))
+}
+
+// RoundMode is like Round but takes a RoundMode.
+func (d Decimal) RoundMode(digit int, mode RoundMode) Decimal {
+	if int64(d.scale) <= int64(digit) {
+		return d
+	}
+	den := pow10(int64(d.scale) - int64(digit))
+	return Decimal{value: roundQuo(d.val(), den, mode), scale: int32(digit)}
+}
+
+// ToFixed is the Decimal version of the ToFixed function.
+func (d Decimal) ToFixed(setting *Setting) Decimal {
+	if setting == nil {
+		return d.Round(DefaultRoundDigit, DefaultRoundStrategy)
+	}
+	return d.Round(setting.RoundDigit, setting.RoundStrategy)
+}
+
+// Float64 returns the nearest float64 value of d.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String formats d without exponent, keeping all decimal places, e.g. "-0.50".
+func (d Decimal) String() string {
+	abs := new(big.Int).Abs(d.val()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		if d.Sign() == 0 {
+			return "0"
+		}
+		return sign + abs + strings.Repeat("0", int(-d.scale))
+	}
+	scale := int(d.scale)
+	if len(abs) <= scale {
+		abs = strings.Repeat("0", scale-len(abs)+1) + abs
+	}
+	return sign + abs[:len(abs)-scale] + "." + abs[len(abs)-scale:]
+}
+
+// MarshalJSON encodes d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, a quoted number or null.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Value implements driver.Valuer. d is stored as a string to keep the precision.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case string:
+		*d, err = ParseDecimal(v)
+	case int64:
+		*d = NewDecimal(v, 0)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("number: cannot scan %v into Decimal", v)
+		}
+		*d = NewDecimalFromFloat(v)
+	default:
+		return fmt.Errorf("number: cannot scan %T into Decimal", src)
+	}
+	return err
+}
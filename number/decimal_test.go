@@ -0,0 +1,143 @@
+package number_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/number"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestParseDecimal(t *testing.T) {
+	testdata := []struct{ in, out string }{
+		{"0", "0"},
+		{"12", "12"},
+		{"-12.340", "-12.340"},
+		{"+.5", "0.5"},
+		{"-0.005", "-0.005"},
+		{"1.5e3", "1500"},
+		{"1.5E-3", "0.0015"},
+		{"1e21", "1000000000000000000000"},
+		{" 3. ", "3"},
+	}
+	for _, d := range testdata {
+		v, err := number.ParseDecimal(d.in)
+		test.Ok(t, err)
+		test.Equals(t, d.out, v.String())
+	}
+
+	for _, s := range []string{"", ".", "-", "1.2.3", "1e", "abc", "1,000"} {
+		_, err := number.ParseDecimal(s)
+		test.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestParseDecimalLimit(t *testing.T) {
+	_, err := number.ParseDecimal("1e-400")
+	test.Ok(t, err)
+	_, err = number.ParseDecimal("1e400")
+	test.Ok(t, err)
+
+	for _, s := range []string{"1e-40000000", "1e401", "0.1e-400", "0." + strings.Repeat("0", 400) + "1"} {
+		_, err := number.ParseDecimal(s)
+		test.Assert(t, err != nil, "expected error for %q", s)
+	}
+
+	var m number.Money
+	err = json.Unmarshal([]byte(`{"amount":"1e-40000000","currency":"CNY"}`), &m)
+	test.Assert(t, err != nil, "expected error for a money out of range")
+}
+
+func TestDecimalFromFloat(t *testing.T) {
+	test.Equals(t, "0.1", number.NewDecimalFromFloat(0.1).String())
+	test.Equals(t, "1000000000000000000000", number.NewDecimalFromFloat(1e21).String())
+	test.Equals(t, "0.0000001", number.NewDecimalFromFloat(1e-7).String())
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a := number.MustParseDecimal("10.25")
+	b := number.MustParseDecimal("-3.1")
+
+	test.Equals(t, "7.15", a.Add(b).String())
+	test.Equals(t, "13.35", a.Sub(b).String())
+	test.Equals(t, "-31.775", a.Mul(b).String())
+	test.Equals(t, "-3.31", a.DivRound(b, 2, "round").String())
+	test.Equals(t, "3.3333333333333333", number.NewDecimal(10, 0).Div(number.NewDecimal(3, 0)).String())
+	test.Equals(t, "0.01", number.NewDecimal(1, 0).DivRound(number.NewDecimal(300, 0), 2, "ceil").String())
+
+	// 0.1 + 0.2 is exactly 0.3
+	sum := number.NewDecimalFromFloat(0.1).Add(number.NewDecimalFromFloat(0.2))
+	test.Equals(t, true, sum.Equal(number.MustParseDecimal("0.30")))
+
+	test.Equals(t, "-10.25", a.Neg().String())
+	test.Equals(t, "3.1", b.Abs().String())
+	test.Equals(t, true, b.LessThan(a))
+	test.Equals(t, true, a.GreaterThan(b))
+	test.Equals(t, true, number.Decimal{}.IsZero())
+	test.Equals(t, "0", number.Decimal{}.String())
+}
+
+func TestDecimalRound(t *testing.T) {
+	testdata := []struct {
+		in       string
+		strategy string
+		out      string
+	}{
+		{"79.9001", "ceil", "79.91"},
+		{"79.9", "ceil", "79.9"},
+		{"-79.9001", "ceil", "-79.90"},
+		{"2.669", "floor", "2.66"},
+		{"-2.661", "floor", "-2.67"},
+		{"2.665", "round", "2.67"},
+		{"-2.665", "round", "-2.67"},
+		{"2.664", "round", "2.66"},
+		{"2.1965", "BankRound", "2.20"},
+		{"2.195", "BankRound", "2.19"},
+		{"2.185", "BankRound", "2.19"},
+		{"-2.185", "BankRound", "-2.19"},
+		{"0.175", "BankRound", "0.17"},
+		{"123456789012345678901.555", "round", "123456789012345678901.56"},
+	}
+	for _, d := range testdata {
+		t.Run(d.in+" "+d.strategy, func(t *testing.T) {
+			test.Equals(t, d.out, number.MustParseDecimal(d.in).Round(2, d.strategy).String())
+		})
+	}
+
+	// bank rounding gives the same results as ToFixed
+	for _, f := range []float64{2.1965, 2.195, 2.185, 2.175, 2.165, .166, .1} {
+		s := &number.Setting{RoundDigit: 2, RoundStrategy: "BankRound"}
+		test.Equals(t, number.ToFixed(f, s), number.NewDecimalFromFloat(f).ToFixed(s).Float64())
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v struct {
+		A number.Decimal  `json:"a"`
+		B number.Decimal  `json:"b"`
+		C *number.Decimal `json:"c"`
+	}
+	test.Ok(t, json.Unmarshal([]byte(`{"a":12.50,"b":"-0.1","c":null}`), &v))
+	test.Equals(t, "12.50", v.A.String())
+	test.Equals(t, "-0.1", v.B.String())
+
+	b, err := json.Marshal(v)
+	test.Ok(t, err)
+	test.Equals(t, `{"a":12.50,"b":-0.1,"c":null}`, string(b))
+}
+
+func TestDecimalSQL(t *testing.T) {
+	var d number.Decimal
+	test.Ok(t, d.Scan([]byte("99.99")))
+	test.Equals(t, "99.99", d.String())
+	test.Ok(t, d.Scan(int64(3)))
+	test.Equals(t, "3", d.String())
+	test.Ok(t, d.Scan(nil))
+	test.Equals(t, true, d.IsZero())
+	test.Assert(t, d.Scan(true) != nil, "expected error")
+
+	v, err := number.MustParseDecimal("1.10").Value()
+	test.Ok(t, err)
+	test.Equals(t, "1.10", v)
+}
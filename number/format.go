@@ -0,0 +1,189 @@
+package number
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Locale describes how numbers are printed in a language/region.
+type Locale struct {
+	Tag            string
+	DecimalMark    string
+	GroupSeparator string
+	GroupSize      int
+	// CurrencyPattern and PercentPattern place the formatted number ("{n}") and the currency symbol ("{s}").
+	// A minus sign is always put in front of the whole result.
+	CurrencyPattern string
+	PercentPattern  string
+	// CurrencySymbols maps ISO 4217 codes to symbols. Currencies without a symbol are printed with their code.
+	CurrencySymbols map[string]string
+}
+
+var locales = struct {
+	sync.RWMutex
+	m map[string]*Locale
+}{m: map[string]*Locale{}}
+
+func init() {
+	RegisterLocale(&Locale{
+		Tag:             "zh-CN",
+		DecimalMark:     ".",
+		GroupSeparator:  ",",
+		GroupSize:       3,
+		CurrencyPattern: "{s}{n}",
+		PercentPattern:  "{n}%",
+		CurrencySymbols: map[string]string{"CNY": "¥", "USD": "US$", "KRW": "₩", "JPY": "JP¥", "HKD": "HK$", "EUR": "€", "GBP": "£"},
+	}, "zh")
+	RegisterLocale(&Locale{
+		Tag:             "ko-KR",
+		DecimalMark:     ".",
+		GroupSeparator:  ",",
+		GroupSize:       3,
+		CurrencyPattern: "{s}{n}",
+		PercentPattern:  "{n}%",
+		CurrencySymbols: map[string]string{"KRW": "₩", "USD": "US$", "CNY": "CN¥", "JPY": "JP¥", "HKD": "HK$", "EUR": "€", "GBP": "£"},
+	}, "ko")
+	RegisterLocale(&Locale{
+		Tag:             "en-US",
+		DecimalMark:     ".",
+		GroupSeparator:  ",",
+		GroupSize:       3,
+		CurrencyPattern: "{s}{n}",
+		PercentPattern:  "{n}%",
+		CurrencySymbols: map[string]string{"USD": "$", "CNY": "CN¥", "KRW": "₩", "JPY": "¥", "HKD": "HK$", "EUR": "€", "GBP": "£"},
+	}, "en")
+}
+
+// RegisterLocale adds or replaces a locale, which can be looked up by its tag or by aliases (e.g. "zh" for "zh-CN").
+func RegisterLocale(l *Locale, aliases ...string) {
+	locales.Lock()
+	defer locales.Unlock()
+	for _, tag := range append([]string{l.Tag}, aliases...) {
+		locales.m[normalizeLocaleTag(tag)] = l
+	}
+}
+
+// LookupLocale returns the locale registered for tag. Tags are case-insensitive, and "_" can be used instead of "-".
+func LookupLocale(tag string) (*Locale, error) {
+	locales.RLock()
+	defer locales.RUnlock()
+	l, ok := locales.m[normalizeLocaleTag(tag)]
+	if !ok {
+		return nil, fmt.Errorf("number: unknown locale %q", tag)
+	}
+	return l, nil
+}
+
+func normalizeLocaleTag(tag string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(tag), "_", "-", -1))
+}
+
+// Format rounds d by setting and prints it with setting.RoundDigit decimal places, e.g. "1,234.50".
+// A nil setting rounds to DefaultRoundDigit with DefaultRoundStrategy.
+func Format(d Decimal, locale string, setting *Setting) (string, error) {
+	l, err := LookupLocale(locale)
+	if err != nil {
+		return "", err
+	}
+	digit, mode, err := formatRounding(setting)
+	if err != nil {
+		return "", err
+	}
+	return l.formatNumber(d.RoundMode(digit, mode), digit), nil
+}
+
+// FormatFloat is like Format for a float64. NaN and infinities are printed as "NaN", "+Inf" and "-Inf".
+func FormatFloat(f float64, locale string, setting *Setting) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f), nil
+	}
+	return Format(NewDecimalFromFloat(f), locale, setting)
+}
+
+// FormatCurrency prints m with the currency symbol of the locale, e.g. "¥1,234.50" or "₩1,235".
+// m is rounded like Money.Round and printed with the decimal places of its currency.
+func FormatCurrency(m Money, locale string, setting *Setting) (string, error) {
+	l, err := LookupLocale(locale)
+	if err != nil {
+		return "", err
+	}
+	rounded, err := m.Round(setting)
+	if err != nil {
+		return "", err
+	}
+	symbol, ok := l.CurrencySymbols[m.currency.Code]
+	if !ok {
+		symbol = m.currency.Code + " "
+	}
+	return l.applyPattern(l.CurrencyPattern, rounded.Amount(), m.currency.MinorUnit, symbol), nil
+}
+
+// FormatPercent prints a ratio as a percentage, e.g. 0.125 => "12.50%". The percentage is rounded by setting.
+func FormatPercent(ratio Decimal, locale string, setting *Setting) (string, error) {
+	l, err := LookupLocale(locale)
+	if err != nil {
+		return "", err
+	}
+	digit, mode, err := formatRounding(setting)
+	if err != nil {
+		return "", err
+	}
+	percent := ratio.Mul(NewDecimal(100, 0)).RoundMode(digit, mode)
+	return l.applyPattern(l.PercentPattern, percent, digit, ""), nil
+}
+
+func formatRounding(setting *Setting) (int, RoundMode, error) {
+	if setting == nil {
+		return DefaultRoundDigit, roundModeOf(DefaultRoundStrategy), nil
+	}
+	mode, err := setting.RoundMode()
+	return setting.RoundDigit, mode, err
+}
+
+func (l *Locale) applyPattern(pattern string, d Decimal, digit int, symbol string) string {
+	n := l.formatNumber(d.Abs(), digit)
+	s := strings.NewReplacer("{n}", n, "{s}", symbol).Replace(pattern)
+	if d.Sign() < 0 {
+		return "-" + s
+	}
+	return s
+}
+
+// formatNumber prints d, which must be rounded to digit decimal places, with digit decimal places.
+func (l *Locale) formatNumber(d Decimal, digit int) string {
+	if digit < 0 {
+		digit = 0
+	}
+	s := new(strings.Builder)
+	if d.Sign() < 0 {
+		s.WriteString("-")
+	}
+	str := d.Abs().String()
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+
+	size := l.GroupSize
+	if size <= 0 {
+		size = len(intPart)
+	}
+	first := len(intPart) % size
+	if first == 0 {
+		first = size
+	}
+	s.WriteString(intPart[:first])
+	for i := first; i < len(intPart); i += size {
+		s.WriteString(l.GroupSeparator)
+		s.WriteString(intPart[i : i+size])
+	}
+
+	if digit > 0 {
+		s.WriteString(l.DecimalMark)
+		s.WriteString(fracPart)
+		s.WriteString(strings.Repeat("0", digit-len(fracPart)))
+	}
+	return s.String()
+}
@@ -0,0 +1,74 @@
+package number_test
+
+import (
+	"testing"
+
+	"github.com/pangpanglabs/goutils/number"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestFormat(t *testing.T) {
+	testdata := []struct {
+		num     string
+		locale  string
+		setting *number.Setting
+		out     string
+	}{
+		{"1234567.891", "en-US", nil, "1,234,567.89"},
+		{"-1234.5", "zh-CN", nil, "-1,234.50"},
+		{"999.995", "ko-KR", nil, "1,000.00"},
+		{"999.995", "ko_kr", &number.Setting{RoundDigit: 2, RoundStrategy: "floor"}, "999.99"},
+		{"123456", "zh", &number.Setting{RoundDigit: 0, RoundStrategy: "round"}, "123,456"},
+		{"0.001", "en-US", nil, "0.00"},
+		{"-0.001", "en-US", nil, "0.00"},
+	}
+	for _, d := range testdata {
+		s, err := number.Format(number.MustParseDecimal(d.num), d.locale, d.setting)
+		test.Ok(t, err)
+		test.Equals(t, d.out, s)
+	}
+
+	s, err := number.FormatFloat(1e21, "en-US", nil)
+	test.Ok(t, err)
+	test.Equals(t, "1,000,000,000,000,000,000,000.00", s)
+
+	_, err = number.Format(number.NewDecimal(1, 0), "fr-FR", nil)
+	test.Assert(t, err != nil, "expected error")
+	_, err = number.Format(number.NewDecimal(1, 0), "en-US", &number.Setting{RoundStrategy: "x"})
+	test.Assert(t, err != nil, "expected error")
+}
+
+func TestFormatCurrency(t *testing.T) {
+	testdata := []struct {
+		amount, currency, locale, out string
+	}{
+		{"1234.5", "CNY", "zh-CN", "¥1,234.50"},
+		{"-1234.5", "CNY", "en-US", "-CN¥1,234.50"},
+		{"1234.5", "USD", "en-US", "$1,234.50"},
+		{"1234.5", "USD", "ko-KR", "US$1,234.50"},
+		{"1234567", "KRW", "ko-KR", "₩1,234,567"},
+		{"12.5", "SGD", "en-US", "SGD 12.50"},
+	}
+	for _, d := range testdata {
+		m, err := number.ParseMoney(d.amount, d.currency)
+		test.Ok(t, err)
+		s, err := number.FormatCurrency(m, d.locale, nil)
+		test.Ok(t, err)
+		test.Equals(t, d.out, s)
+	}
+
+	m, _ := number.ParseMoney("12.35", "CNY")
+	s, err := number.FormatCurrency(m, "zh-CN", &number.Setting{RoundDigit: 1, RoundStrategy: "round"})
+	test.Ok(t, err)
+	test.Equals(t, "¥12.40", s)
+}
+
+func TestFormatPercent(t *testing.T) {
+	s, err := number.FormatPercent(number.MustParseDecimal("0.125"), "en-US", nil)
+	test.Ok(t, err)
+	test.Equals(t, "12.50%", s)
+
+	s, err = number.FormatPercent(number.MustParseDecimal("-0.0333"), "zh-CN", &number.Setting{RoundDigit: 0, RoundStrategy: "round"})
+	test.Ok(t, err)
+	test.Equals(t, "-3%", s)
+}
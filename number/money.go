@@ -0,0 +1,300 @@
+package number
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("number: currency mismatch")
+	ErrUnknownCurrency  = errors.New("number: unknown currency")
+	ErrPrecision        = errors.New("number: amount has more decimal places than the currency allows")
+	ErrInvalidRatios    = errors.New("number: ratios must not be negative and must not all be zero")
+)
+
+// Currency is an ISO 4217 currency.
+// MinorUnit is the number of decimal places of the currency, e.g. 2 for CNY and 0 for KRW.
+type Currency struct {
+	Code      string
+	MinorUnit int
+}
+
+var currencies = struct {
+	sync.RWMutex
+	m map[string]Currency
+}{m: map[string]Currency{}}
+
+func init() {
+	for code, minorUnit := range map[string]int{
+		"AUD": 2, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2, "GBP": 2, "HKD": 2, "IDR": 2,
+		"INR": 2, "JPY": 0, "KRW": 0, "MOP": 2, "MYR": 2, "NZD": 2, "PHP": 2, "RUB": 2,
+		"SGD": 2, "THB": 2, "TWD": 2, "USD": 2, "VND": 0, "BHD": 3, "KWD": 3,
+	} {
+		RegisterCurrency(code, minorUnit)
+	}
+}
+
+// RegisterCurrency adds or replaces a currency. Codes are case-insensitive.
+func RegisterCurrency(code string, minorUnit int) {
+	currencies.Lock()
+	defer currencies.Unlock()
+	code = strings.ToUpper(code)
+	currencies.m[code] = Currency{Code: code, MinorUnit: minorUnit}
+}
+
+// LookupCurrency returns the registered currency for code.
+func LookupCurrency(code string) (Currency, error) {
+	currencies.RLock()
+	defer currencies.RUnlock()
+	c, ok := currencies.m[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return c, nil
+}
+
+// Money is an amount in a currency. The amount always has the precision of the currency,
+// and arithmetic between different currencies returns ErrCurrencyMismatch.
+type Money struct {
+	amount   Decimal
+	currency Currency
+}
+
+// NewMoney returns amount in the given currency.
+// It returns ErrPrecision if amount can't be represented without rounding (e.g. 1.005 CNY); see NewMoneyRound.
+func NewMoney(amount Decimal, currencyCode string) (Money, error) {
+	c, err := LookupCurrency(currencyCode)
+	if err != nil {
+		return Money{}, err
+	}
+	rounded := amount.RoundMode(c.MinorUnit, RoundTowardZero)
+	if !rounded.Equal(amount) {
+		return Money{}, fmt.Errorf("%w: %s %s", ErrPrecision, amount, c.Code)
+	}
+	return Money{amount: rescaleTo(rounded, c.MinorUnit), currency: c}, nil
+}
+
+// NewMoneyRound returns amount rounded by setting in the given currency (see Money.Round).
+func NewMoneyRound(amount Decimal, currencyCode string, setting *Setting) (Money, error) {
+	c, err := LookupCurrency(currencyCode)
+	if err != nil {
+		return Money{}, err
+	}
+	digit, mode, err := moneyRounding(c, setting)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: rescaleTo(amount.RoundMode(digit, mode), c.MinorUnit), currency: c}, nil
+}
+
+// NewMoneyFromMinor returns an amount given in minor units, e.g. NewMoneyFromMinor(1999, "CNY") is 19.99 CNY.
+func NewMoneyFromMinor(minor int64, currencyCode string) (Money, error) {
+	c, err := LookupCurrency(currencyCode)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{amount: NewDecimal(minor, int32(c.MinorUnit)), currency: c}, nil
+}
+
+// ParseMoney parses amount like ParseDecimal and calls NewMoney.
+func ParseMoney(amount, currencyCode string) (Money, error) {
+	d, err := ParseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(d, currencyCode)
+}
+
+// moneyRounding returns the digit and mode used to round an amount of currency c.
+// A nil setting rounds to the minor unit with DefaultRoundStrategy;
+// setting.RoundDigit is used only if it's less than the minor unit (e.g. rounding CNY to 0.1).
+func moneyRounding(c Currency, setting *Setting) (int, RoundMode, error) {
+	if setting == nil {
+		return c.MinorUnit, roundModeOf(DefaultRoundStrategy), nil
+	}
+	mode, err := setting.RoundMode()
+	if err != nil {
+		return 0, mode, err
+	}
+	digit := c.MinorUnit
+	if setting.RoundDigit < digit {
+		digit = setting.RoundDigit
+	}
+	return digit, mode, nil
+}
+
+// rescaleTo returns d with exactly scale decimal places. d must not have more than scale decimal places.
+func rescaleTo(d Decimal, scale int) Decimal {
+	return Decimal{value: d.rescale(int32(scale)), scale: int32(scale)}
+}
+
+func (m Money) Amount() Decimal            { return rescaleTo(m.amount, m.currency.MinorUnit) }
+func (m Money) Currency() Currency         { return m.currency }
+func (m Money) IsZero() bool               { return m.amount.IsZero() }
+func (m Money) Sign() int                  { return m.amount.Sign() }
+func (m Money) Float64() float64           { return m.amount.Float64() }
+func (m Money) String() string             { return m.Amount().String() + " " + m.currency.Code }
+func (m Money) Neg() Money                 { return Money{amount: m.amount.Neg(), currency: m.currency} }
+func (m Money) Abs() Money                 { return Money{amount: m.amount.Abs(), currency: m.currency} }
+func (m Money) withAmount(d Decimal) Money { return Money{amount: d, currency: m.currency} }
+
+// Minor returns the amount in minor units, e.g. 1999 for 19.99 CNY.
+func (m Money) Minor() *big.Int {
+	return new(big.Int).Set(m.Amount().val())
+}
+
+func (m Money) SameCurrency(m2 Money) bool {
+	return m.currency.Code == m2.currency.Code
+}
+
+func (m Money) checkCurrency(m2 Money) error {
+	if !m.SameCurrency(m2) {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency.Code, m2.currency.Code)
+	}
+	return nil
+}
+
+func (m Money) Add(m2 Money) (Money, error) {
+	if err := m.checkCurrency(m2); err != nil {
+		return Money{}, err
+	}
+	return m.withAmount(m.amount.Add(m2.amount)), nil
+}
+
+func (m Money) Sub(m2 Money) (Money, error) {
+	if err := m.checkCurrency(m2); err != nil {
+		return Money{}, err
+	}
+	return m.withAmount(m.amount.Sub(m2.amount)), nil
+}
+
+// Cmp compares two amounts of the same currency.
+func (m Money) Cmp(m2 Money) (int, error) {
+	if err := m.checkCurrency(m2); err != nil {
+		return 0, err
+	}
+	return m.amount.Cmp(m2.amount), nil
+}
+
+// Equal reports whether m and m2 have the same currency and amount.
+func (m Money) Equal(m2 Money) bool {
+	return m.SameCurrency(m2) && m.amount.Equal(m2.amount)
+}
+
+// Mul multiplies m by factor (e.g. a quantity or a discount rate), and rounds the result like Round.
+func (m Money) Mul(factor Decimal, setting *Setting) (Money, error) {
+	return m.withAmount(m.amount.Mul(factor)).Round(setting)
+}
+
+// Round rounds m with setting.RoundStrategy. The result keeps the precision of the currency,
+// but if setting.RoundDigit is less than it, the amount is rounded to RoundDigit (e.g. 12.35 CNY => 12.40 CNY with RoundDigit 1).
+// A nil setting rounds to the minor unit with DefaultRoundStrategy.
+func (m Money) Round(setting *Setting) (Money, error) {
+	digit, mode, err := moneyRounding(m.currency, setting)
+	if err != nil {
+		return Money{}, err
+	}
+	return m.withAmount(rescaleTo(m.amount.RoundMode(digit, mode), m.currency.MinorUnit)), nil
+}
+
+// Allocate splits m by ratios without losing or creating minor units: the results always sum up to m.
+// Each part first gets its share rounded toward zero, then the remaining minor units are given one by one
+// to the parts with the largest dropped fractions (earlier parts first on ties).
+// Ratios are typically line amounts or weights; they must not be negative and must not all be zero.
+func (m Money) Allocate(ratios ...Decimal) ([]Money, error) {
+	if len(ratios) == 0 {
+		return nil, ErrInvalidRatios
+	}
+	var scale int32
+	for _, r := range ratios {
+		if r.Sign() < 0 {
+			return nil, ErrInvalidRatios
+		}
+		if r.scale > scale {
+			scale = r.scale
+		}
+	}
+	weights := make([]*big.Int, len(ratios))
+	sum := new(big.Int)
+	for i, r := range ratios {
+		weights[i] = r.rescale(scale)
+		sum.Add(sum, weights[i])
+	}
+	if sum.Sign() == 0 {
+		return nil, ErrInvalidRatios
+	}
+
+	total := m.Minor()
+	sign := total.Sign()
+	total.Abs(total)
+
+	type part struct {
+		index     int
+		remainder *big.Int
+	}
+	shares := make([]*big.Int, len(ratios))
+	parts := make([]part, len(ratios))
+	left := new(big.Int).Set(total)
+	for i, w := range weights {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(total, w), sum, new(big.Int))
+		shares[i] = q
+		parts[i] = part{index: i, remainder: r}
+		left.Sub(left, q)
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].remainder.Cmp(parts[j].remainder) > 0
+	})
+	// left is less than len(ratios), because each share lost less than one minor unit
+	for i := int64(0); i < left.Int64(); i++ {
+		shares[parts[i].index].Add(shares[parts[i].index], big.NewInt(1))
+	}
+
+	result := make([]Money, len(ratios))
+	for i, s := range shares {
+		if sign < 0 {
+			s.Neg(s)
+		}
+		result[i] = m.withAmount(Decimal{value: s, scale: int32(m.currency.MinorUnit)})
+	}
+	return result, nil
+}
+
+// Split splits m into n parts which differ by at most one minor unit, e.g. for installments.
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, ErrInvalidRatios
+	}
+	ratios := make([]Decimal, n)
+	for i := range ratios {
+		ratios[i] = NewDecimal(1, 0)
+	}
+	return m.Allocate(ratios...)
+}
+
+type moneyJSON struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount":12.30,"currency":"CNY"}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Amount(), Currency: m.currency.Code})
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	money, err := NewMoney(v.Amount, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
@@ -0,0 +1,142 @@
+package number_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/number"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func mustMoney(t *testing.T, amount, currency string) number.Money {
+	m, err := number.ParseMoney(amount, currency)
+	test.Ok(t, err)
+	return m
+}
+
+func TestNewMoney(t *testing.T) {
+	test.Equals(t, "10.50 CNY", mustMoney(t, "10.5", "cny").String())
+	test.Equals(t, "1000 KRW", mustMoney(t, "1000.00", "KRW").String())
+
+	_, err := number.ParseMoney("10.005", "CNY")
+	test.Assert(t, errors.Is(err, number.ErrPrecision), "expected ErrPrecision, got %v", err)
+	_, err = number.ParseMoney("10", "XXX")
+	test.Assert(t, errors.Is(err, number.ErrUnknownCurrency), "expected ErrUnknownCurrency, got %v", err)
+
+	m, err := number.NewMoneyFromMinor(1999, "USD")
+	test.Ok(t, err)
+	test.Equals(t, "19.99 USD", m.String())
+	test.Equals(t, int64(1999), m.Minor().Int64())
+
+	m, err = number.NewMoneyRound(number.MustParseDecimal("1000.5"), "KRW", &number.Setting{RoundDigit: 2, RoundStrategy: "half_even"})
+	test.Ok(t, err)
+	test.Equals(t, "1000 KRW", m.String())
+
+	number.RegisterCurrency("xts", 4)
+	test.Equals(t, "1.2345 XTS", mustMoney(t, "1.2345", "XTS").String())
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a := mustMoney(t, "10.25", "CNY")
+	b := mustMoney(t, "0.75", "CNY")
+
+	sum, err := a.Add(b)
+	test.Ok(t, err)
+	test.Equals(t, "11.00 CNY", sum.String())
+
+	diff, err := b.Sub(a)
+	test.Ok(t, err)
+	test.Equals(t, "-9.50 CNY", diff.String())
+
+	c, err := a.Cmp(b)
+	test.Ok(t, err)
+	test.Equals(t, 1, c)
+
+	_, err = a.Add(mustMoney(t, "1", "KRW"))
+	test.Assert(t, errors.Is(err, number.ErrCurrencyMismatch), "expected ErrCurrencyMismatch, got %v", err)
+	test.Equals(t, false, a.Equal(mustMoney(t, "10.25", "USD")))
+
+	// 10.25 × 0.85 = 8.7125
+	m, err := a.Mul(number.MustParseDecimal("0.85"), nil)
+	test.Ok(t, err)
+	test.Equals(t, "8.71 CNY", m.String())
+	m, err = a.Mul(number.MustParseDecimal("0.85"), &number.Setting{RoundDigit: 2, RoundStrategy: "ceil"})
+	test.Ok(t, err)
+	test.Equals(t, "8.72 CNY", m.String())
+	m, err = a.Mul(number.MustParseDecimal("0.85"), &number.Setting{RoundDigit: 1, RoundStrategy: "floor"})
+	test.Ok(t, err)
+	test.Equals(t, "8.70 CNY", m.String())
+	_, err = a.Mul(number.MustParseDecimal("0.85"), &number.Setting{RoundDigit: 2, RoundStrategy: "unknown"})
+	test.Assert(t, err != nil, "expected error")
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	t.Run("even", func(t *testing.T) {
+		parts, err := mustMoney(t, "100", "CNY").Split(3)
+		test.Ok(t, err)
+		test.Equals(t, []string{"33.34 CNY", "33.33 CNY", "33.33 CNY"}, moneyStrings(parts))
+	})
+	t.Run("ratios", func(t *testing.T) {
+		// a discount of 10 over lines of 30, 30 and 40
+		parts, err := mustMoney(t, "-10", "CNY").Allocate(
+			number.MustParseDecimal("33.33"),
+			number.MustParseDecimal("33.33"),
+			number.MustParseDecimal("33.34"),
+		)
+		test.Ok(t, err)
+		test.Equals(t, []string{"-3.33 CNY", "-3.33 CNY", "-3.34 CNY"}, moneyStrings(parts))
+	})
+	t.Run("largest remainder", func(t *testing.T) {
+		// 1.5 and 3.5 cents: the tie goes to the first part
+		parts, err := mustMoney(t, "0.05", "USD").Allocate(
+			number.NewDecimal(3, 1), number.NewDecimal(7, 1),
+		)
+		test.Ok(t, err)
+		test.Equals(t, []string{"0.02 USD", "0.03 USD"}, moneyStrings(parts))
+
+		// 0.6, 1.8 and 2.6 cents
+		parts, err = mustMoney(t, "0.05", "USD").Allocate(
+			number.NewDecimal(3, 0), number.NewDecimal(9, 0), number.NewDecimal(13, 0),
+		)
+		test.Ok(t, err)
+		test.Equals(t, []string{"0.01 USD", "0.02 USD", "0.02 USD"}, moneyStrings(parts))
+	})
+	t.Run("no lost cents", func(t *testing.T) {
+		total := mustMoney(t, "999", "KRW")
+		parts, err := total.Allocate(number.NewDecimal(1, 0), number.NewDecimal(1, 0), number.NewDecimal(5, 0), number.NewDecimal(0, 0))
+		test.Ok(t, err)
+		sum, _ := number.NewMoneyFromMinor(0, "KRW")
+		for _, p := range parts {
+			sum, err = sum.Add(p)
+			test.Ok(t, err)
+		}
+		test.Equals(t, true, sum.Equal(total))
+		test.Equals(t, true, parts[3].IsZero())
+	})
+	t.Run("invalid ratios", func(t *testing.T) {
+		_, err := mustMoney(t, "1", "CNY").Allocate(number.NewDecimal(0, 0))
+		test.Assert(t, errors.Is(err, number.ErrInvalidRatios), "expected ErrInvalidRatios, got %v", err)
+		_, err = mustMoney(t, "1", "CNY").Allocate(number.NewDecimal(1, 0), number.NewDecimal(-1, 0))
+		test.Assert(t, errors.Is(err, number.ErrInvalidRatios), "expected ErrInvalidRatios, got %v", err)
+	})
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(mustMoney(t, "12.3", "CNY"))
+	test.Ok(t, err)
+	test.Equals(t, `{"amount":12.30,"currency":"CNY"}`, string(b))
+
+	var m number.Money
+	test.Ok(t, json.Unmarshal(b, &m))
+	test.Equals(t, "12.30 CNY", m.String())
+	test.Assert(t, json.Unmarshal([]byte(`{"amount":1.001,"currency":"CNY"}`), &m) != nil, "expected error")
+}
+
+func moneyStrings(list []number.Money) []string {
+	s := make([]string, len(list))
+	for i, m := range list {
+		s[i] = m.String()
+	}
+	return s
+}
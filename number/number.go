@@ -1,10 +1,8 @@
 package number
 
 import (
-	"fmt"
+	"encoding/json"
 	"math"
-	"strconv"
-	"strings"
 )
 
 type Setting struct {
@@ -17,6 +15,44 @@ const (
 	DefaultRoundStrategy = "round"
 )
 
+// NewSetting returns a Setting, or an error if strategy is unknown (see ParseRoundMode).
+func NewSetting(roundDigit int, strategy string) (*Setting, error) {
+	s := Setting{RoundDigit: roundDigit, RoundStrategy: strategy}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate returns an error if RoundStrategy is unknown.
+// JSON is validated by UnmarshalJSON, and config files read by config.Read are validated by it.
+func (s Setting) Validate() error {
+	_, err := ParseRoundMode(s.RoundStrategy)
+	return err
+}
+
+// RoundMode returns the parsed RoundStrategy.
+func (s Setting) RoundMode() (RoundMode, error) {
+	return ParseRoundMode(s.RoundStrategy)
+}
+
+func (s *Setting) UnmarshalJSON(b []byte) error {
+	type setting Setting
+	var v setting
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if err := Setting(v).Validate(); err != nil {
+		return err
+	}
+	*s = Setting(v)
+	return nil
+}
+
+// ToFixed rounds num to setting.RoundDigit decimal places.
+// num is rounded as its shortest decimal representation (2.675 is rounded as 2.675, not as 2.67499999...),
+// so the result doesn't depend on float errors and works for any magnitude.
+// Unknown strategies are treated as RoundBank for compatibility, and logged; use Setting.Validate to reject them.
 func ToFixed(num float64, setting *Setting) float64 {
 	if setting == nil {
 		setting = &Setting{
@@ -24,44 +60,15 @@ func ToFixed(num float64, setting *Setting) float64 {
 			RoundStrategy: DefaultRoundStrategy,
 		}
 	}
-	switch setting.RoundStrategy {
-	case "ceil", "Ceil":
-		output := math.Pow(10, float64(setting.RoundDigit))
-		f, _ := strconv.ParseFloat(strconv.FormatFloat(num*output, 'f', 6, 64), 64)
-		return math.Ceil(f) / output
-	case "floor", "Floor":
-		output := math.Pow(10, float64(setting.RoundDigit))
-		f, _ := strconv.ParseFloat(strconv.FormatFloat(num*output, 'f', 6, 64), 64)
-		return math.Floor(f) / output
-	case "round", "Round":
-		output := math.Pow(10, float64(setting.RoundDigit))
-		return float64(Round(num*output)) / output
-	default: // BankRound
-		s := fmt.Sprint(num)                      // "2.1965"
-		pointPos := strings.Index(s, ".")         // 1
-		roundPos := pointPos + setting.RoundDigit // 3
-
-		if pointPos < 0 || roundPos+1 >= len(s) {
-			return num
-		}
-
-		intNum, _ := strconv.ParseInt(s[:pointPos]+s[pointPos+1:roundPos+1], 10, 64) // 219
-
-		switch s[roundPos] {
-		case '0', '2', '4', '6', '8':
-			if s[roundPos+1] >= '5' {
-				intNum += 1
-			}
-		default:
-			if s[roundPos+1] > '5' {
-				intNum += 1
-			}
-		}
-
-		return float64(intNum) / math.Pow(10, float64(setting.RoundDigit))
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return num
 	}
+	return NewDecimalFromFloat(num).Round(setting.RoundDigit, setting.RoundStrategy).Float64()
 }
 
+// Round rounds num half away from zero.
+//
+// Deprecated: the result overflows for large numbers. Use math.Round or ToFixed with RoundDigit 0.
 func Round(num float64) int {
 	return int(num + math.Copysign(0.5, num))
 }
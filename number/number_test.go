@@ -1,6 +1,7 @@
 package number_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/pangpanglabs/goutils/number"
@@ -110,3 +111,75 @@ func TestBankRound(t *testing.T) {
 		test.Equals(t, d.b, fixedNumber)
 	}
 }
+
+func TestRoundModes(t *testing.T) {
+	testdata := []struct {
+		num                                                               float64
+		halfUp, halfDown, halfEven, awayFromZero, towardZero, ceil, floor float64
+	}{
+		{2.5, 3, 2, 2, 3, 2, 3, 2},
+		{-2.5, -2, -3, -2, -3, -2, -2, -3},
+		{3.5, 4, 3, 4, 4, 3, 4, 3},
+		{-3.5, -3, -4, -4, -4, -3, -3, -4},
+		{2.6, 3, 3, 3, 3, 2, 3, 2},
+		{-2.4, -2, -2, -2, -2, -2, -2, -3},
+		{-2, -2, -2, -2, -2, -2, -2, -2},
+		{1e20 + 0.5, 1e20, 1e20, 1e20, 1e20, 1e20, 1e20, 1e20},
+		{-4503599627370495.5, -4503599627370495, -4503599627370496, -4503599627370496, -4503599627370496, -4503599627370495, -4503599627370495, -4503599627370496},
+	}
+	for _, d := range testdata {
+		for strategy, expected := range map[string]float64{
+			"half_up":             d.halfUp,
+			"half_down":           d.halfDown,
+			"half_even":           d.halfEven,
+			"half_away_from_zero": d.awayFromZero,
+			"toward_zero":         d.towardZero,
+			"ceil":                d.ceil,
+			"floor":               d.floor,
+		} {
+			result := number.ToFixed(d.num, &number.Setting{RoundDigit: 0, RoundStrategy: strategy})
+			test.Assert(t, result == expected, "%v %s: expected %v, got %v", d.num, strategy, expected, result)
+		}
+	}
+
+	// float errors don't change the result
+	test.Equals(t, 2.68, number.ToFixed(2.675, &number.Setting{RoundDigit: 2, RoundStrategy: "round"}))
+	test.Equals(t, 1.01, number.ToFixed(1.005, &number.Setting{RoundDigit: 2, RoundStrategy: "HalfUp"}))
+	test.Equals(t, -2.68, number.ToFixed(-2.675, &number.Setting{RoundDigit: 2, RoundStrategy: "round"}))
+	test.Equals(t, 1e22, number.ToFixed(1e22, &number.Setting{RoundDigit: 2, RoundStrategy: "round"}))
+	test.Equals(t, 123456789012.35, number.ToFixed(123456789012.345, &number.Setting{RoundDigit: 2, RoundStrategy: "round"}))
+}
+
+func TestParseRoundMode(t *testing.T) {
+	for strategy, mode := range map[string]number.RoundMode{
+		"round":     number.RoundHalfAwayFromZero,
+		"Ceil":      number.RoundCeiling,
+		"FLOOR":     number.RoundFloor,
+		"HalfEven":  number.RoundHalfEven,
+		"half-down": number.RoundHalfDown,
+		"BankRound": number.RoundBank,
+		"":          number.RoundBank,
+	} {
+		m, err := number.ParseRoundMode(strategy)
+		test.Ok(t, err)
+		test.Equals(t, mode, m)
+	}
+
+	_, err := number.ParseRoundMode("ciel")
+	test.Assert(t, err != nil, "expected error")
+
+	_, err = number.NewSetting(2, "rond")
+	test.Assert(t, err != nil, "expected error")
+	s, err := number.NewSetting(2, "half_even")
+	test.Ok(t, err)
+	test.Equals(t, &number.Setting{RoundDigit: 2, RoundStrategy: "half_even"}, s)
+
+	var v number.Setting
+	test.Ok(t, json.Unmarshal([]byte(`{"roundDigit":1,"roundStrategy":"floor"}`), &v))
+	test.Equals(t, number.Setting{RoundDigit: 1, RoundStrategy: "floor"}, v)
+	test.Assert(t, json.Unmarshal([]byte(`{"roundDigit":1,"roundStrategy":"flor"}`), &v) != nil, "expected error")
+
+	b, err := json.Marshal(struct{ Mode number.RoundMode }{number.RoundHalfEven})
+	test.Ok(t, err)
+	test.Equals(t, `{"Mode":"half_even"}`, string(b))
+}
@@ -0,0 +1,223 @@
+package number
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+)
+
+var (
+	ErrNoLines         = errors.New("number: no lines to prorate")
+	ErrInvalidDiscount = errors.New("number: discount must not be negative or greater than the amount")
+	ErrInvalidWeights  = errors.New("number: weights must not be negative and must not all be zero")
+	ErrInvalidTaxRate  = errors.New("number: tax rate must not be negative")
+)
+
+// TaxMode tells whether line amounts include tax.
+type TaxMode int
+
+const (
+	// TaxExclusive: line amounts exclude tax, and tax is added on top of them.
+	TaxExclusive TaxMode = iota
+	// TaxInclusive: line amounts include tax, and tax is extracted from them.
+	TaxInclusive
+)
+
+type ProrateLine struct {
+	// Amount is the line amount before the order discount, e.g. unit price × quantity.
+	Amount Decimal
+	// Weight is the share of the order discount the line takes. If all weights are zero, Amount is used.
+	Weight Decimal
+	// TaxRate is e.g. 0.13 for 13%.
+	TaxRate Decimal
+}
+
+type ProratedLine struct {
+	Amount   Decimal // rounded line amount before the discount
+	Discount Decimal // share of the order discount
+	Net      Decimal // amount after the discount, excluding tax
+	Tax      Decimal
+	Total    Decimal // amount after the discount, including tax
+}
+
+// Proration is the result of Prorate. The fields of the header are the sums of the same fields of Lines.
+type Proration struct {
+	Amount   Decimal
+	Discount Decimal
+	Net      Decimal
+	Tax      Decimal
+	Total    Decimal
+	Lines    []ProratedLine
+}
+
+// Prorate spreads an order discount over lines by weight and computes the tax of each line.
+//
+// Every header value (amount, discount and tax) is rounded once by setting, from the exact sum of the lines.
+// Each line then gets its exact value rounded down, and the units left by rounding (e.g. cents)
+// are given one by one to the lines with the largest dropped fractions, earlier lines first on ties.
+// So the lines always sum up exactly to the header, and no line is off by more than one unit.
+// A nil setting rounds to DefaultRoundDigit with DefaultRoundStrategy.
+func Prorate(lines []ProrateLine, discount Decimal, taxMode TaxMode, setting *Setting) (*Proration, error) {
+	if len(lines) == 0 {
+		return nil, ErrNoLines
+	}
+	if setting == nil {
+		setting = &Setting{RoundDigit: DefaultRoundDigit, RoundStrategy: DefaultRoundStrategy}
+	}
+	mode, err := setting.RoundMode()
+	if err != nil {
+		return nil, err
+	}
+	digit := setting.RoundDigit
+
+	amounts := make([]*big.Rat, len(lines))
+	for i, l := range lines {
+		if l.TaxRate.Sign() < 0 {
+			return nil, ErrInvalidTaxRate
+		}
+		amounts[i] = l.Amount.rat()
+	}
+	amount, lineAmounts := distribute(amounts, digit, mode)
+
+	discount = rescaleTo(discount.RoundMode(digit, mode), digit)
+	if discount.Sign() < 0 || discount.GreaterThan(amount) {
+		return nil, ErrInvalidDiscount
+	}
+	discounts, err := prorateDiscount(lines, lineAmounts, discount, digit, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	p := Proration{
+		Amount:   amount,
+		Discount: discount,
+		Lines:    make([]ProratedLine, len(lines)),
+	}
+
+	taxes := make([]*big.Rat, len(lines))
+	for i, l := range lines {
+		after := lineAmounts[i].Sub(discounts[i]).rat()
+		rate := l.TaxRate.rat()
+		if taxMode == TaxInclusive {
+			// tax = after × rate / (1 + rate)
+			rate.Quo(rate, new(big.Rat).Add(big.NewRat(1, 1), rate))
+		}
+		taxes[i] = after.Mul(after, rate)
+	}
+	var lineTaxes []Decimal
+	p.Tax, lineTaxes = distribute(taxes, digit, mode)
+
+	for i := range lines {
+		line := ProratedLine{
+			Amount:   lineAmounts[i],
+			Discount: discounts[i],
+			Tax:      lineTaxes[i],
+		}
+		after := line.Amount.Sub(line.Discount)
+		if taxMode == TaxInclusive {
+			line.Total, line.Net = after, after.Sub(line.Tax)
+		} else {
+			line.Net, line.Total = after, after.Add(line.Tax)
+		}
+		p.Lines[i] = line
+	}
+	after := amount.Sub(discount)
+	if taxMode == TaxInclusive {
+		p.Total, p.Net = after, after.Sub(p.Tax)
+	} else {
+		p.Net, p.Total = after, after.Add(p.Tax)
+	}
+
+	return &p, nil
+}
+
+func prorateDiscount(lines []ProrateLine, lineAmounts []Decimal, discount Decimal, digit int, mode RoundMode) ([]Decimal, error) {
+	weights := make([]*big.Rat, len(lines))
+	sum := new(big.Rat)
+	for i, l := range lines {
+		if l.Weight.Sign() < 0 {
+			return nil, ErrInvalidWeights
+		}
+		weights[i] = l.Weight.rat()
+		sum.Add(sum, weights[i])
+	}
+	if sum.Sign() == 0 {
+		for i := range lines {
+			if lineAmounts[i].Sign() < 0 {
+				return nil, ErrInvalidWeights
+			}
+			weights[i] = lineAmounts[i].rat()
+			sum.Add(sum, weights[i])
+		}
+	}
+	if sum.Sign() == 0 {
+		if discount.IsZero() {
+			_, zeros := distribute(weights, digit, mode)
+			return zeros, nil
+		}
+		return nil, ErrInvalidWeights
+	}
+
+	shares := make([]*big.Rat, len(lines))
+	for i, w := range weights {
+		shares[i] = new(big.Rat).Mul(discount.rat(), new(big.Rat).Quo(w, sum))
+	}
+	_, discounts := distribute(shares, digit, mode)
+	return discounts, nil
+}
+
+// distribute rounds the sum of exact values to digit decimal places with mode,
+// and rounds each value so that they sum up to the rounded sum (see Prorate).
+func distribute(exact []*big.Rat, digit int, mode RoundMode) (Decimal, []Decimal) {
+	scale := new(big.Rat).SetInt(pow10(int64(abs(digit))))
+	if digit < 0 {
+		scale.Inv(scale)
+	}
+
+	type part struct {
+		index int
+		frac  *big.Rat
+	}
+	units := make([]*big.Int, len(exact))
+	parts := make([]part, len(exact))
+	sum, floorSum := new(big.Rat), new(big.Int)
+	for i, e := range exact {
+		x := new(big.Rat).Mul(e, scale)
+		sum.Add(sum, x)
+		// the denominator of a big.Rat is always positive, so Div is a floor division
+		units[i] = new(big.Int).Div(x.Num(), x.Denom())
+		floorSum.Add(floorSum, units[i])
+		parts[i] = part{index: i, frac: x.Sub(x, new(big.Rat).SetInt(units[i]))}
+	}
+	total := roundQuo(sum.Num(), sum.Denom(), mode)
+
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].frac.Cmp(parts[j].frac) > 0
+	})
+	// left is between 0 and the number of lines with a fraction, because floorSum <= floor(sum) <= total <= ceil(sum)
+	left := new(big.Int).Sub(total, floorSum).Int64()
+	for i := int64(0); i < left; i++ {
+		units[parts[i].index].Add(units[parts[i].index], big.NewInt(1))
+	}
+
+	lines := make([]Decimal, len(exact))
+	for i, u := range units {
+		lines[i] = Decimal{value: u, scale: int32(digit)}
+	}
+	return Decimal{value: total, scale: int32(digit)}, lines
+}
+
+// rat returns d as an exact fraction.
+func (d Decimal) rat() *big.Rat {
+	if d.scale < 0 {
+		return new(big.Rat).SetInt(d.rescale(0))
+	}
+	return new(big.Rat).SetFrac(d.val(), pow10(int64(d.scale)))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
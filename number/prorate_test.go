@@ -0,0 +1,105 @@
+package number_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/number"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestProrate(t *testing.T) {
+	d := number.MustParseDecimal
+
+	t.Run("tax exclusive", func(t *testing.T) {
+		p, err := number.Prorate([]number.ProrateLine{
+			{Amount: d("10"), TaxRate: d("0.13")},
+			{Amount: d("10"), TaxRate: d("0.13")},
+			{Amount: d("10"), TaxRate: d("0.13")},
+		}, d("1"), number.TaxExclusive, nil)
+		test.Ok(t, err)
+
+		test.Equals(t, "30.00", p.Amount.String())
+		test.Equals(t, "1.00", p.Discount.String())
+		test.Equals(t, "29.00", p.Net.String())
+		test.Equals(t, "3.77", p.Tax.String())
+		test.Equals(t, "32.77", p.Total.String())
+
+		test.Equals(t, []string{"0.34", "0.33", "0.33"}, lineStrings(p, func(l number.ProratedLine) number.Decimal { return l.Discount }))
+		// 9.66 × 0.13 = 1.2558, 9.67 × 0.13 = 1.2571
+		test.Equals(t, []string{"1.25", "1.26", "1.26"}, lineStrings(p, func(l number.ProratedLine) number.Decimal { return l.Tax }))
+		test.Equals(t, []string{"10.91", "10.93", "10.93"}, lineStrings(p, func(l number.ProratedLine) number.Decimal { return l.Total }))
+		assertSums(t, p)
+	})
+	t.Run("tax inclusive", func(t *testing.T) {
+		p, err := number.Prorate([]number.ProrateLine{
+			{Amount: d("19.99"), TaxRate: d("0.13")},
+			{Amount: d("5.01"), TaxRate: d("0.06")},
+			{Amount: d("0.01"), TaxRate: d("0.13")},
+		}, d("0"), number.TaxInclusive, nil)
+		test.Ok(t, err)
+
+		test.Equals(t, "25.01", p.Total.String())
+		// 19.99 × 0.13/1.13 = 2.2997..., 5.01 × 0.06/1.06 = 0.2835..., 0.01 × 0.13/1.13 = 0.0011...
+		test.Equals(t, "2.58", p.Tax.String())
+		test.Equals(t, []string{"2.30", "0.28", "0.00"}, lineStrings(p, func(l number.ProratedLine) number.Decimal { return l.Tax }))
+		test.Equals(t, "22.43", p.Net.String())
+		assertSums(t, p)
+	})
+	t.Run("weights", func(t *testing.T) {
+		p, err := number.Prorate([]number.ProrateLine{
+			{Amount: d("50"), Weight: d("1")},
+			{Amount: d("50"), Weight: d("0")},
+			{Amount: d("50"), Weight: d("2")},
+		}, d("10"), number.TaxExclusive, &number.Setting{RoundDigit: 2, RoundStrategy: "half_even"})
+		test.Ok(t, err)
+		test.Equals(t, []string{"3.33", "0.00", "6.67"}, lineStrings(p, func(l number.ProratedLine) number.Decimal { return l.Discount }))
+		assertSums(t, p)
+	})
+	t.Run("unrounded amounts", func(t *testing.T) {
+		// unit price 3.333 × 3
+		p, err := number.Prorate([]number.ProrateLine{
+			{Amount: d("3.333")},
+			{Amount: d("3.333")},
+			{Amount: d("3.333")},
+		}, d("0.1"), number.TaxExclusive, &number.Setting{RoundDigit: 1, RoundStrategy: "round"})
+		test.Ok(t, err)
+		test.Equals(t, "10.0", p.Amount.String())
+		test.Equals(t, []string{"3.4", "3.3", "3.3"}, lineStrings(p, func(l number.ProratedLine) number.Decimal { return l.Amount }))
+		assertSums(t, p)
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, err := number.Prorate(nil, d("0"), number.TaxExclusive, nil)
+		test.Assert(t, errors.Is(err, number.ErrNoLines), "expected ErrNoLines, got %v", err)
+		_, err = number.Prorate([]number.ProrateLine{{Amount: d("1")}}, d("2"), number.TaxExclusive, nil)
+		test.Assert(t, errors.Is(err, number.ErrInvalidDiscount), "expected ErrInvalidDiscount, got %v", err)
+		_, err = number.Prorate([]number.ProrateLine{{Amount: d("1"), Weight: d("-1")}}, d("0"), number.TaxExclusive, nil)
+		test.Assert(t, errors.Is(err, number.ErrInvalidWeights), "expected ErrInvalidWeights, got %v", err)
+		_, err = number.Prorate([]number.ProrateLine{{Amount: d("1")}}, d("0"), number.TaxExclusive, &number.Setting{RoundStrategy: "x"})
+		test.Assert(t, err != nil, "expected error")
+	})
+}
+
+func lineStrings(p *number.Proration, field func(number.ProratedLine) number.Decimal) []string {
+	s := make([]string, len(p.Lines))
+	for i, l := range p.Lines {
+		s[i] = field(l).String()
+	}
+	return s
+}
+
+func assertSums(t *testing.T, p *number.Proration) {
+	var amount, discount, net, tax, total number.Decimal
+	for _, l := range p.Lines {
+		amount = amount.Add(l.Amount)
+		discount = discount.Add(l.Discount)
+		net = net.Add(l.Net)
+		tax = tax.Add(l.Tax)
+		total = total.Add(l.Total)
+	}
+	test.Assert(t, amount.Equal(p.Amount), "amount: %s != %s", amount, p.Amount)
+	test.Assert(t, discount.Equal(p.Discount), "discount: %s != %s", discount, p.Discount)
+	test.Assert(t, net.Equal(p.Net), "net: %s != %s", net, p.Net)
+	test.Assert(t, tax.Equal(p.Tax), "tax: %s != %s", tax, p.Tax)
+	test.Assert(t, total.Equal(p.Total), "total: %s != %s", total, p.Total)
+}
@@ -0,0 +1,151 @@
+package number
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// RoundMode is a rounding strategy. Setting.RoundStrategy is parsed into a RoundMode by ParseRoundMode.
+type RoundMode int
+
+const (
+	// RoundBank rounds away from zero if the first dropped digit is greater than 5,
+	// or if it is 5 and the last kept digit is even. Later digits are ignored.
+	// This is the rule ToFixed has always used for "BankRound" and unknown strategies,
+	// and it is kept for compatibility; use RoundHalfEven for banker's rounding.
+	RoundBank RoundMode = iota
+	// RoundHalfUp rounds to the nearest neighbor, ties toward positive infinity: 2.5 => 3, -2.5 => -2.
+	RoundHalfUp
+	// RoundHalfDown rounds to the nearest neighbor, ties toward negative infinity: 2.5 => 2, -2.5 => -3.
+	RoundHalfDown
+	// RoundHalfEven rounds to the nearest neighbor, ties to the even neighbor: 2.5 => 2, 3.5 => 4.
+	RoundHalfEven
+	// RoundHalfAwayFromZero rounds to the nearest neighbor, ties away from zero: 2.5 => 3, -2.5 => -3.
+	RoundHalfAwayFromZero
+	// RoundTowardZero truncates: 2.9 => 2, -2.9 => -2.
+	RoundTowardZero
+	// RoundCeiling rounds toward positive infinity: 2.1 => 3, -2.9 => -2.
+	RoundCeiling
+	// RoundFloor rounds toward negative infinity: 2.9 => 2, -2.1 => -3.
+	RoundFloor
+)
+
+var roundModeNames = map[RoundMode]string{
+	RoundBank:             "bank",
+	RoundHalfUp:           "half_up",
+	RoundHalfDown:         "half_down",
+	RoundHalfEven:         "half_even",
+	RoundHalfAwayFromZero: "round",
+	RoundTowardZero:       "toward_zero",
+	RoundCeiling:          "ceil",
+	RoundFloor:            "floor",
+}
+
+// strategy names are compared in lower case without "_", "-" and spaces, so "HalfEven" and "half-even" are the same.
+var roundModesByName = map[string]RoundMode{
+	"":                 RoundBank, // an empty strategy has always been bank rounding
+	"bank":             RoundBank,
+	"bankround":        RoundBank,
+	"halfup":           RoundHalfUp,
+	"halfdown":         RoundHalfDown,
+	"halfeven":         RoundHalfEven,
+	"round":            RoundHalfAwayFromZero,
+	"halfawayfromzero": RoundHalfAwayFromZero,
+	"towardzero":       RoundTowardZero,
+	"truncate":         RoundTowardZero,
+	"ceil":             RoundCeiling,
+	"ceiling":          RoundCeiling,
+	"floor":            RoundFloor,
+}
+
+// ParseRoundMode parses a rounding strategy like "round", "ceil", "floor", "half_even" or "BankRound".
+// Unknown strategies are rejected.
+func ParseRoundMode(strategy string) (RoundMode, error) {
+	name := strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(strategy))
+	mode, ok := roundModesByName[name]
+	if !ok {
+		return RoundBank, fmt.Errorf("number: unknown round strategy %q", strategy)
+	}
+	return mode, nil
+}
+
+// unknownStrategies are the unknown strategies which have been logged by roundModeOf.
+var unknownStrategies sync.Map
+
+// roundModeOf is used where no error can be returned, e.g. ToFixed.
+// Unknown strategies fall back to RoundBank like they always have, and are logged once;
+// use Setting.Validate (or config.Read) to reject them.
+func roundModeOf(strategy string) RoundMode {
+	mode, err := ParseRoundMode(strategy)
+	if err != nil {
+		if _, logged := unknownStrategies.LoadOrStore(strategy, true); !logged {
+			log.Printf("%v, bank rounding is used instead", err)
+		}
+	}
+	return mode
+}
+
+func (m RoundMode) String() string {
+	if name, ok := roundModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("RoundMode(%d)", int(m))
+}
+
+func (m RoundMode) MarshalText() ([]byte, error) {
+	if _, ok := roundModeNames[m]; !ok {
+		return nil, fmt.Errorf("number: unknown round mode %d", int(m))
+	}
+	return []byte(m.String()), nil
+}
+
+func (m *RoundMode) UnmarshalText(text []byte) error {
+	mode, err := ParseRoundMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// roundQuo returns num / den rounded to an integer with the given mode.
+func roundQuo(num, den *big.Int, mode RoundMode) *big.Int {
+	if den.Sign() < 0 {
+		num, den = new(big.Int).Neg(num), new(big.Int).Neg(den)
+	}
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := num.Sign()
+	// half compares the remainder with a half of den: -1 below, 0 exactly, +1 above
+	half := new(big.Int).Lsh(new(big.Int).Abs(r), 1).Cmp(den)
+
+	var up bool // whether to move q one step away from zero
+	switch mode {
+	case RoundHalfUp:
+		up = half > 0 || half == 0 && sign > 0
+	case RoundHalfDown:
+		up = half > 0 || half == 0 && sign < 0
+	case RoundHalfEven:
+		up = half > 0 || half == 0 && q.Bit(0) == 1
+	case RoundHalfAwayFromZero:
+		up = half >= 0
+	case RoundTowardZero:
+		up = false
+	case RoundCeiling:
+		up = sign > 0
+	case RoundFloor:
+		up = sign < 0
+	default: // RoundBank
+		first := new(big.Int).Quo(new(big.Int).Mul(new(big.Int).Abs(r), bigTen), den).Int64()
+		up = first > 5 || first == 5 && q.Bit(0) == 0
+	}
+	if up {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}